@@ -0,0 +1,425 @@
+package lildiffer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Bracketed monomial names spell out the subexpression they
+// stand for, so equal trees get equal names and any name
+// can be read back without a registry. The spelling follows
+// Read, e.g. [Sin((x*y))] or [P{map[:1 x:1]}], except that
+// nothing is simplified away and names that could be
+// mistaken for something else are quoted.
+
+// atomKey spells out e
+func atomKey(e Expression) string {
+	switch v := e.(type) {
+	case Num:
+		return formatNum(v.Val)
+	case Var:
+		return quoteName(v.Name)
+	case Cos:
+		return "Cos(" + atomKey(v.E1) + ")"
+	case Sin:
+		return "Sin(" + atomKey(v.E1) + ")"
+	case Pow:
+		return atomKey(v.Base) + "^" + formatNum(v.Exponent)
+	case Add:
+		return "(" + atomKey(v.E1) + "+" + atomKey(v.E2) + ")"
+	case Mul:
+		return "(" + atomKey(v.E1) + "*" + atomKey(v.E2) + ")"
+	case Div:
+		return "(" + atomKey(v.E1) + "/" + atomKey(v.E2) + ")"
+	case Poly:
+		var terms []string
+		for _, key := range sortedKeys(v.terms) {
+			terms = append(terms, key+":"+formatNum(v.terms[key]))
+		}
+		return "P{map[" + strings.Join(terms, " ") + "]}"
+	case con:
+		return "CONST(" + atomKey(v.E1) + ")"
+	case UndefinedFunction:
+		var args []string
+		for _, a := range v.Args {
+			args = append(args, atomKey(a))
+		}
+		name := v.Name
+		if reserved[name] || !isName(name) {
+			name = quote(name)
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	case Derivative:
+		s := atomKey(v.F)
+		for _, w := range v.Wrt {
+			s += ", " + quoteName(w.Name)
+		}
+		return "D(" + s + ")"
+	case At:
+		s := atomKey(v.F)
+		for i, w := range v.Vars {
+			s += ", " + quoteName(w.Name) + "=" + atomKey(v.Vals[i])
+		}
+		return "At(" + s + ")"
+	}
+	panic(fmt.Sprintf("no polynomial name for %T", e))
+}
+
+// reserved names would read back as
+// something other than a function call
+var reserved = map[string]bool{
+	"Sin": true, "Cos": true, "D": true, "At": true, "CONST": true, "P": true, "NaN": true,
+}
+
+func formatNum(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func isName(s string) bool {
+	for i, r := range s {
+		if !(unicode.IsLetter(r) || r == '_' || r == '#' || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// quote keeps brackets out of the
+// quoted text, so they stay balanced
+func quote(s string) string {
+	s = strconv.Quote(s)
+	s = strings.Replace(s, "[", `\x5b`, -1)
+	return strings.Replace(s, "]", `\x5d`, -1)
+}
+
+func quoteName(name string) string {
+	if reserved[name] || !isName(name) {
+		return quote(name)
+	}
+	return name
+}
+
+// parseAtom reads a bracketed monomial name
+// back into the expression it spells out
+func parseAtom(name string) (Expression, error) {
+	if len(name) < 2 || name[0] != '[' || name[len(name)-1] != ']' {
+		return nil, fmt.Errorf("polynomial atom %q isn't bracketed", name)
+	}
+	p := atomParser{s: name[1 : len(name)-1]}
+	e, err := p.expression()
+	if err == nil && p.i != len(p.s) {
+		err = p.errorf("trailing text")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("polynomial atom %v: %v", name, err)
+	}
+	return e, nil
+}
+
+type atomParser struct {
+	s string
+	i int
+}
+
+func (p *atomParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("at %v: %v", p.i, fmt.Sprintf(format, a...))
+}
+
+func (p *atomParser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func (p *atomParser) expect(s string) error {
+	if !strings.HasPrefix(p.s[p.i:], s) {
+		return p.errorf("want %q", s)
+	}
+	p.i += len(s)
+	return nil
+}
+
+func (p *atomParser) number() (float64, error) {
+	start := p.i
+	if c := p.peek(); c == '+' || c == '-' {
+		p.i++
+	}
+	if strings.HasPrefix(p.s[p.i:], "Inf") {
+		p.i += 3
+	} else {
+		digits := func() {
+			for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+				p.i++
+			}
+		}
+		digits()
+		if p.peek() == '.' {
+			p.i++
+			digits()
+		}
+		if c := p.peek(); c == 'e' || c == 'E' {
+			p.i++
+			if c := p.peek(); c == '+' || c == '-' {
+				p.i++
+			}
+			digits()
+		}
+	}
+	f, err := strconv.ParseFloat(p.s[start:p.i], 64)
+	if err != nil {
+		return 0, p.errorf("%v", err)
+	}
+	return f, nil
+}
+
+// name reads a plain or quoted name
+func (p *atomParser) name() (string, error) {
+	if p.peek() == '"' {
+		// up to the first unescaped quote
+		end := p.i + 1
+		for ; end < len(p.s) && p.s[end] != '"'; end++ {
+			if p.s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.s) {
+			return "", p.errorf("unterminated quote")
+		}
+		s, err := strconv.Unquote(p.s[p.i : end+1])
+		if err != nil {
+			return "", p.errorf("%v", err)
+		}
+		p.i = end + 1
+		return s, nil
+	}
+	start := p.i
+	for p.i < len(p.s) {
+		r, n := utf8.DecodeRuneInString(p.s[p.i:])
+		if !(unicode.IsLetter(r) || r == '_' || r == '#' || (p.i > start && unicode.IsDigit(r))) {
+			break
+		}
+		p.i += n
+	}
+	if p.i == start {
+		return "", p.errorf("want a name")
+	}
+	return p.s[start:p.i], nil
+}
+
+// list reads comma separated items up to the closing
+// parenthesis, the opening one already read
+func (p *atomParser) list(item func() error) error {
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		if p.peek() == ')' {
+			p.i++
+			return nil
+		}
+		if err := p.expect(", "); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *atomParser) expression() (Expression, error) {
+	e, err := p.primary()
+	for err == nil && p.peek() == '^' {
+		p.i++
+		var n float64
+		n, err = p.number()
+		e = Pow{e, n}
+	}
+	return e, err
+}
+
+func (p *atomParser) primary() (Expression, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.i++
+		a, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		op := p.peek()
+		p.i++
+		b, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		switch op {
+		case '+':
+			return Add{a, b}, nil
+		case '*':
+			return Mul{a, b}, nil
+		case '/':
+			return Div{a, b}, nil
+		}
+		return nil, p.errorf("unknown operator %q", op)
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		f, err := p.number()
+		return Num{f}, err
+	}
+
+	quoted := c == '"'
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if !quoted && name == "NaN" {
+		f, _ := strconv.ParseFloat(name, 64)
+		return Num{f}, nil
+	}
+	if !quoted && name == "P" {
+		return p.poly()
+	}
+	if p.peek() != '(' {
+		return Var{name}, nil
+	}
+	p.i++
+	var args []Expression
+	arg := func() error {
+		a, err := p.expression()
+		args = append(args, a)
+		return err
+	}
+	if quoted || !reserved[name] {
+		if p.peek() == ')' {
+			p.i++
+			return UndefinedFunction{name, nil}, nil
+		}
+		if err := p.list(arg); err != nil {
+			return nil, err
+		}
+		return UndefinedFunction{name, args}, nil
+	}
+
+	switch name {
+	case "Sin", "Cos", "CONST":
+		a, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "Sin":
+			return Sin{a}, nil
+		case "Cos":
+			return Cos{a}, nil
+		}
+		return con{a}, nil
+	case "D":
+		f, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		d := Derivative{F: f}
+		if err := p.expect(", "); err != nil {
+			return nil, err
+		}
+		err = p.list(func() error {
+			w, err := p.name()
+			d.Wrt = append(d.Wrt, Var{w})
+			return err
+		})
+		return d, err
+	case "At":
+		f, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		a := At{F: f}
+		if err := p.expect(", "); err != nil {
+			return nil, err
+		}
+		err = p.list(func() error {
+			w, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("="); err != nil {
+				return err
+			}
+			val, err := p.expression()
+			a.Vars, a.Vals = append(a.Vars, Var{w}), append(a.Vals, val)
+			return err
+		})
+		return a, err
+	}
+	return nil, p.errorf("%v isn't a function", name)
+}
+
+// poly reads the terms of a polynomial, P already read.
+// Keys hold no colons outside their own brackets.
+func (p *atomParser) poly() (Expression, error) {
+	if err := p.expect("{map["); err != nil {
+		return nil, err
+	}
+	terms := make(map[string]float64)
+	for p.peek() != ']' {
+		if len(terms) > 0 {
+			if err := p.expect(" "); err != nil {
+				return nil, err
+			}
+		}
+		start, depth := p.i, 0
+		for ; p.i < len(p.s) && (depth > 0 || p.s[p.i] != ':'); p.i++ {
+			switch p.s[p.i] {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			}
+		}
+		key := p.s[start:p.i]
+		if err := checkKey(key); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		c, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		terms[key] = c
+	}
+	if err := p.expect("]}"); err != nil {
+		return nil, err
+	}
+	return Poly{terms}, nil
+}
+
+// checkKey reports whether key is a well formed monomial,
+// reading back every atom in it
+func checkKey(key string) error {
+	monomials, _, err := decomposeKey(key)
+	if err != nil {
+		return err
+	}
+	for _, m := range monomials {
+		if strings.HasPrefix(m, "[") {
+			if _, err := parseAtom(m); err != nil {
+				return err
+			}
+			continue
+		}
+		// bare letters are what polyName
+		// gives single letter variables
+		if len(m) != 1 || m[0] < 'a' || m[0] > 'z' {
+			return fmt.Errorf("monomial %q has an indeterminate %q", key, m)
+		}
+	}
+	return nil
+}
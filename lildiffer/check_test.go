@@ -0,0 +1,47 @@
+package lildiffer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheckDerivative(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	e := Add{Mul{Sin{Mul{x, y}}, Pow{x, 3.}}, Div{Cos{x}, Add{Num{2.}, Pow{y, 2.}}}}
+	if c := CheckDerivative(e, x); c.Points != 20 || c.RelErr > 1e-8 {
+		t.Errorf("CheckDerivative got %+v", c)
+	}
+	at := map[string]float64{"x": .5, "y": 1}
+	if c := CheckDerivative(e, y, at); c.Points != 1 || c.RelErr > 1e-8 {
+		t.Errorf("CheckDerivative at a point got %+v", c)
+	}
+
+	// the extrapolated difference itself is
+	// good to near machine precision
+	if got, want := richardson(Pow{x, 5.}, x, at), 5*.0625; !almostEqual(got, want) {
+		t.Errorf("richardson x^5 got %v, want %v", got, want)
+	}
+
+	// points where e isn't finite are skipped
+	if c := CheckDerivative(Pow{x, -1.}, x, map[string]float64{"x": 0}); c.Points != 0 {
+		t.Errorf("CheckDerivative at a pole got %+v", c)
+	}
+}
+
+func TestDeriveProperty(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	g := newGenerator(47, x, y)
+	// within the unit square nested powers
+	// don't oscillate past the step size
+	var points []map[string]float64
+	for k := 0; k < 5; k++ {
+		points = append(points, map[string]float64{
+			"x": 2*g.r.Float64() - 1, "y": 2*g.r.Float64() - 1})
+	}
+	checkProperty(t, "PartialDerive agrees with finite differences", g, 200, func(e Expression) error {
+		if c := CheckDerivative(e, x, points...); c.RelErr > 1e-6 {
+			return fmt.Errorf("%v vs %v at %v", c.Symbolic, c.Numeric, c.At)
+		}
+		return nil
+	})
+}
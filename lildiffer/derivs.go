@@ -0,0 +1,114 @@
+package lildiffer
+
+import (
+	"sort"
+	"strconv"
+)
+
+// A MultiIndex gives how many times to differentiate
+// with respect to each variable, e.g. {x: 2, y: 1}
+// for d^3/dx^2dy.
+type MultiIndex map[Var]int
+
+// Order is the total number of derivatives.
+func (m MultiIndex) Order() int {
+	n := 0
+	for _, k := range m {
+		n += k
+	}
+	return n
+}
+
+// Factorial is the product of the factorials
+// of the orders, as in Taylor coefficients.
+func (m MultiIndex) Factorial() float64 {
+	f := 1.
+	for _, k := range m {
+		for i := 2; i <= k; i++ {
+			f *= float64(i)
+		}
+	}
+	return f
+}
+
+// vars lists the variables with nonzero
+// order, sorted by name
+func (m MultiIndex) vars() []Var {
+	var vs []Var
+	for v, k := range m {
+		if k > 0 {
+			vs = append(vs, v)
+		}
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i].Name < vs[j].Name
+	})
+	return vs
+}
+
+// key is the same for any order of
+// differentiation, so mixed partials
+// share cache entries
+func (m MultiIndex) key() string {
+	var s string
+	for _, v := range m.vars() {
+		s += v.Name + "^" + strconv.Itoa(m[v]) + " "
+	}
+	return s
+}
+
+// A DerivativeTable computes partial derivatives of
+// one expression, simplifying between steps and caching
+// every intermediate order. Derivatives commute
+// (Schwarz), so d/dxdy and d/dydx are computed once.
+type DerivativeTable struct {
+	e     Expression
+	cache map[string]Expression
+}
+
+// NewDerivativeTable starts an empty table for e.
+func NewDerivativeTable(e Expression) *DerivativeTable {
+	return &DerivativeTable{e, make(map[string]Expression)}
+}
+
+// Partial returns the derivative of the table's
+// expression described by m.
+func (t *DerivativeTable) Partial(m MultiIndex) Expression {
+	key := m.key()
+	if d, ok := t.cache[key]; ok {
+		return d
+	}
+	var d Expression
+	vs := m.vars()
+	if len(vs) == 0 {
+		d = makePoly(Simplify(t.e))
+	} else {
+		// peel off one derivative in the
+		// first variable and recurse
+		v := vs[0]
+		prev := make(MultiIndex)
+		for u, k := range m {
+			prev[u] = k
+		}
+		prev[v]--
+		d = makePoly(Simplify(PartialDerive(v, t.Partial(prev))))
+	}
+	t.cache[key] = d
+	return d
+}
+
+// NthDerivative is the nth partial derivative
+// of e with respect to v.
+func NthDerivative(e Expression, v Var, n int) Expression {
+	return NewDerivativeTable(e).Partial(MultiIndex{v: n})
+}
+
+// MixedPartial differentiates e once with respect
+// to each of vars, in any order.
+func MixedPartial(e Expression, vars []Var) Expression {
+	m := make(MultiIndex)
+	for _, v := range vars {
+		m[v]++
+	}
+	return NewDerivativeTable(e).Partial(m)
+}
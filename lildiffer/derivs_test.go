@@ -0,0 +1,77 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNthDerivative(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	env := map[string]float64{"x": .3, "y": 1.7}
+	table := []struct {
+		description string
+		f           Expression
+		v           Var
+		n           int
+		want        float64
+	}{
+		{"d^4/dx^4 sin(x)", Sin{x}, x, 4, math.Sin(.3)},
+		{"d^7/dx^7 sin(x)", Sin{x}, x, 7, -math.Cos(.3)},
+		{"d^3/dx^3 x^5 y", Mul{Pow{x, 5.}, y}, x, 3, 60 * .09 * 1.7},
+		{"d^6/dx^6 x^5 y", Mul{Pow{x, 5.}, y}, x, 6, 0},
+		{"d^2/dy^2 cos(xy)", Cos{Mul{x, y}}, y, 2, -.09 * math.Cos(.3*1.7)},
+		{"d^0/dx^0 x+y", Add{x, y}, x, 0, 2},
+	}
+	for _, tt := range table {
+		d := NthDerivative(tt.f, tt.v, tt.n)
+		if got := Eval(d, env); !almostEqual(got, tt.want) {
+			t.Errorf("NthDerivative %v got %v = %v, want %v",
+				tt.description, Read(d), got, tt.want)
+		}
+	}
+}
+
+func TestMixedPartial(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	env := map[string]float64{"x": .3, "y": 1.7}
+	table := []struct {
+		description string
+		f           Expression
+		vars        []Var
+		want        float64
+	}{
+		{"d^3/dxdydy x^2 y^3", Mul{Pow{x, 2.}, Pow{y, 3.}}, []Var{x, y, y}, 12 * .3 * 1.7},
+		{"d^2/dxdy sin(xy)", Sin{Mul{x, y}}, []Var{x, y},
+			math.Cos(.51) - .51*math.Sin(.51)},
+		{"d^2/dydx sin(xy)", Sin{Mul{x, y}}, []Var{y, x},
+			math.Cos(.51) - .51*math.Sin(.51)},
+	}
+	for _, tt := range table {
+		d := MixedPartial(tt.f, tt.vars)
+		if got := Eval(d, env); !almostEqual(got, tt.want) {
+			t.Errorf("MixedPartial %v got %v = %v, want %v",
+				tt.description, Read(d), got, tt.want)
+		}
+	}
+}
+
+func TestDerivativeTableSchwarz(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	table := NewDerivativeTable(Mul{Sin{x}, Pow{y, 3.}})
+	dxdy := table.Partial(MultiIndex{x: 1, y: 1})
+	// e, d/dy, d/dxdy
+	if len(table.cache) != 3 {
+		t.Errorf("want 3 cached partials, got %v", len(table.cache))
+	}
+	dydx := table.Partial(MultiIndex{y: 1, x: 1, Var{"z"}: 0})
+	if len(table.cache) != 3 || Read(dxdy) != Read(dydx) {
+		t.Errorf("mixed partials not shared: %v vs %v", Read(dxdy), Read(dydx))
+	}
+	table.Partial(MultiIndex{x: 2, y: 1})
+	if len(table.cache) != 4 {
+		t.Errorf("want 4 cached partials, got %v", len(table.cache))
+	}
+	if f := (MultiIndex{x: 3, y: 2}).Factorial(); f != 12 {
+		t.Errorf("Factorial got %v, want 12", f)
+	}
+}
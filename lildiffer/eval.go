@@ -0,0 +1,131 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// Eval computes the value of e with its
+// variables bound by env. It panics on a
+// variable env doesn't bind.
+func Eval(e Expression, env map[string]float64) float64 {
+	f := func(e Expression) float64 {
+		return Eval(e, env)
+	}
+	switch v := e.(type) {
+	case con:
+		return f(v.E1)
+	case polyWrt:
+		return evalPoly(v.P, env)
+	case Num:
+		return v.Val
+	case Var:
+		val, ok := env[v.Name]
+		if !ok {
+			panic("unbound variable " + v.Name)
+		}
+		return val
+	case Poly:
+		return evalPoly(v, env)
+	case Cos:
+		return math.Cos(f(v.E1))
+	case Sin:
+		return math.Sin(f(v.E1))
+	case Pow:
+		return math.Pow(f(v.Base), v.Exponent)
+	case Div:
+		return f(v.E1) / f(v.E2)
+	case Mul:
+		return f(v.E1) * f(v.E2)
+	case Add:
+		return f(v.E1) + f(v.E2)
+	case UndefinedFunction:
+		panic("can't evaluate undefined function " + v.Name)
+	case Derivative:
+		if _, ok := v.F.(UndefinedFunction); !ok {
+			return f(evaluateDerivative(v))
+		}
+		panic("can't evaluate unevaluated derivative " + Read(v))
+	case At:
+		inner := make(map[string]float64, len(env)+len(v.Vars))
+		for k, val := range env {
+			inner[k] = val
+		}
+		for i, w := range v.Vars {
+			inner[w.Name] = f(v.Vals[i])
+		}
+		return Eval(v.F, inner)
+	}
+	panic("eval tried to reach undefined type in tree")
+}
+
+// evalPoly is the naive evaluation, parsing
+// every monomial as it goes.
+func evalPoly(p Poly, env map[string]float64) float64 {
+	sum := 0.
+	for key, coef := range p.terms {
+		t := coef
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			t *= math.Pow(Eval(indeterminate(m), env), float64(exponents[i]))
+		}
+		sum += t
+	}
+	return sum
+}
+
+// magnitude bounds the size of the intermediate values
+// evaluating e at env goes through, so rounding error is
+// at most a small multiple of it times the unit roundoff.
+// Rearranging e, like expanding a product, can't lower
+// that error below its magnitude.
+func magnitude(e Expression, env map[string]float64) float64 {
+	f := func(e Expression) float64 {
+		return magnitude(e, env)
+	}
+	switch v := e.(type) {
+	case Num:
+		return math.Abs(v.Val)
+	case Var:
+		return math.Abs(env[v.Name])
+	case con:
+		return f(v.E1)
+	case polyWrt:
+		return f(v.P)
+	case Poly:
+		sum := 0.
+		for key, coef := range v.terms {
+			t := math.Abs(coef)
+			monomials, exponents := decomposePoly(key)
+			for i, m := range monomials {
+				a := indeterminate(m)
+				if exponents[i] < 0 {
+					t *= f(Pow{a, float64(exponents[i])})
+					continue
+				}
+				t *= math.Pow(f(a), float64(exponents[i]))
+			}
+			sum += t
+		}
+		return sum
+	case Add:
+		return f(v.E1) + f(v.E2)
+	case Mul:
+		return f(v.E1) * f(v.E2)
+	case Div:
+		// first order error propagation
+		a, b := Eval(v.E1, env), Eval(v.E2, env)
+		return f(v.E1)/math.Abs(b) + math.Abs(a)*f(v.E2)/(b*b)
+	case Pow:
+		if v.Exponent >= 0 && isInteger(v.Exponent) {
+			return math.Pow(f(v.Base), v.Exponent)
+		}
+		b := Eval(v.Base, env)
+		return math.Abs(math.Pow(b, v.Exponent)) +
+			math.Abs(v.Exponent*math.Pow(b, v.Exponent-1))*f(v.Base)
+	case Sin:
+		return 1 + f(v.E1)
+	case Cos:
+		return 1 + f(v.E1)
+	}
+	panic("magnitude tried to reach undefined type in tree")
+}
@@ -0,0 +1,43 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	type ptype map[string]float64
+	x, y := Var{"x"}, Var{"y"}
+	env := map[string]float64{"x": 2., "y": -1.5, "theta": .5}
+	table := []struct {
+		description string
+		f           Expression
+		want        float64
+	}{
+		{"sin(6 * sin(x))",
+			Sin{Mul{Num{6.0}, Sin{x}}},
+			math.Sin(6 * math.Sin(2)),
+		},
+		{"(3x+9) / (2-y)",
+			Div{Add{Mul{Num{3.0}, x}, Num{9.}}, Add{Num{2.}, Mul{Num{-1.}, y}}},
+			15. / 3.5,
+		},
+		{"con(x)^3 + Cos(theta)",
+			Add{Pow{con{x}, 3.}, Cos{Var{"theta"}}},
+			8 + math.Cos(.5),
+		},
+		{"x^2y + 4 - y^-1",
+			newPoly(ptype{"x^2y": 1, "": 4, "y^-1": -1}),
+			-6 + 4 + 1/1.5,
+		},
+		{"Sin(x)^2 x as a poly",
+			makePoly(Mul{Pow{Sin{x}, 2.}, x}),
+			math.Pow(math.Sin(2), 2) * 2,
+		},
+	}
+	for _, tt := range table {
+		if got := Eval(tt.f, env); !almostEqual(got, tt.want) {
+			t.Errorf("Eval %v got %v, want %v", tt.description, got, tt.want)
+		}
+	}
+}
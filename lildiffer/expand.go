@@ -0,0 +1,337 @@
+package lildiffer
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a coefficient times powers of opaque
+// factors, keyed by their atomKey
+type product struct {
+	coef   float64
+	powers map[string]int
+}
+
+func (p product) key() string {
+	var parts []string
+	for _, k := range sortedPowers(p.powers) {
+		parts = append(parts, strconv.Quote(k)+"^"+strconv.Itoa(p.powers[k]))
+	}
+	return strings.Join(parts, "|")
+}
+
+// a sum of products, keyed by product.key
+type sum map[string]product
+
+// expander remembers which expression
+// each factor key stands for
+type expander struct {
+	atoms map[string]Expression
+}
+
+func (x *expander) atom(e Expression, power int) sum {
+	key := atomKey(e)
+	x.atoms[key] = e
+	return single(product{1., map[string]int{key: power}})
+}
+
+func constant(c float64) sum {
+	if c == 0 {
+		return sum{}
+	}
+	return sum{"": product{c, map[string]int{}}}
+}
+
+func (s sum) add(t sum) sum {
+	r := make(sum)
+	for _, part := range []sum{s, t} {
+		for k, p := range part {
+			if p.coef == 0 {
+				continue
+			}
+			if q, ok := r[k]; ok {
+				if cancels(q.coef, p.coef) {
+					delete(r, k)
+					continue
+				}
+				p = product{q.coef + p.coef, p.powers}
+			}
+			r[k] = p
+		}
+	}
+	return r
+}
+
+func (s sum) mul(t sum) sum {
+	r := make(sum)
+	for _, p := range s {
+		for _, q := range t {
+			powers := make(map[string]int)
+			for k, n := range p.powers {
+				powers[k] += n
+			}
+			for k, n := range q.powers {
+				powers[k] += n
+				if powers[k] == 0 {
+					delete(powers, k)
+				}
+			}
+			r = r.add(single(product{p.coef * q.coef, powers}))
+		}
+	}
+	return r
+}
+
+func single(p product) sum {
+	return sum{p.key(): p}
+}
+
+// pow raises s to n >= 0, scaling a single product
+// and squaring and multiplying anything else
+func (s sum) pow(n int) sum {
+	if len(s) == 1 {
+		for _, p := range s {
+			c := math.Pow(p.coef, float64(n))
+			if c == 0 {
+				return sum{}
+			}
+			powers := make(map[string]int)
+			for k, m := range p.powers {
+				if m*n != 0 {
+					powers[k] = m * n
+				}
+			}
+			return single(product{c, powers})
+		}
+	}
+	r := constant(1.)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			r = r.mul(s)
+		}
+		if n > 1 {
+			s = s.mul(s)
+		}
+	}
+	return r
+}
+
+// invert returns 1/s when s is a single product
+func (s sum) invert() (sum, bool) {
+	if len(s) != 1 {
+		return nil, false
+	}
+	for _, p := range s {
+		powers := make(map[string]int)
+		for k, n := range p.powers {
+			powers[k] = -n
+		}
+		return single(product{1 / p.coef, powers}), true
+	}
+	return nil, false
+}
+
+func isInteger(f float64) bool {
+	return f == math.Trunc(f) && math.Abs(f) < 1<<31
+}
+
+func (x *expander) expand(e Expression) sum {
+	switch v := e.(type) {
+	case con:
+		return x.expand(v.E1)
+	case polyWrt:
+		return x.expand(v.P)
+	case Num:
+		return constant(v.Val)
+	case Var:
+		return x.atom(v, 1)
+	case Poly:
+		r := sum{}
+		for key, coef := range v.terms {
+			t := constant(coef)
+			monomials, exponents := decomposePoly(key)
+			for i, m := range monomials {
+				t = t.mul(x.atom(indeterminate(m), exponents[i]))
+			}
+			r = r.add(t)
+		}
+		return r
+	case Add:
+		return x.expand(v.E1).add(x.expand(v.E2))
+	case Mul:
+		return x.expand(v.E1).mul(x.expand(v.E2))
+	case Div:
+		return x.expand(v.E1).mul(x.reciprocal(v.E2, 1))
+	case Pow:
+		if !isInteger(v.Exponent) {
+			return x.atom(Pow{x.build(x.expand(v.Base)), v.Exponent}, 1)
+		}
+		n := int(v.Exponent)
+		if n < 0 {
+			return x.reciprocal(v.Base, -n)
+		}
+		s := x.expand(v.Base)
+		if len(s) > 1 && expansion(len(s), n) > maxExpansion {
+			// too many terms to multiply out
+			return x.atom(x.build(s), n)
+		}
+		return s.pow(n)
+	case Sin:
+		return x.atom(Sin{x.build(x.expand(v.E1))}, 1)
+	case Cos:
+		return x.atom(Cos{x.build(x.expand(v.E1))}, 1)
+	case UndefinedFunction:
+		args := make([]Expression, len(v.Args))
+		for i, a := range v.Args {
+			args[i] = x.build(x.expand(a))
+		}
+		return x.atom(UndefinedFunction{v.Name, args}, 1)
+	case Derivative:
+		return x.atom(Derivative{x.build(x.expand(v.F)), v.Wrt}, 1)
+	case At:
+		vals := make([]Expression, len(v.Vals))
+		for i, a := range v.Vals {
+			vals[i] = x.build(x.expand(a))
+		}
+		return x.atom(At{x.build(x.expand(v.F)), v.Vars, vals}, 1)
+	}
+	panic("expand tried to reach undefined type in tree")
+}
+
+// reciprocal expands 1/e^n. Monomials invert
+// exactly, anything else, 0 included, becomes
+// an opaque factor with a negative power.
+func (x *expander) reciprocal(e Expression, n int) sum {
+	s := x.expand(e)
+	if r, ok := s.invert(); ok {
+		return r.pow(n)
+	}
+	return x.atom(x.build(s), -n)
+}
+
+// build turns a sum back into an expression tree,
+// nested to the right like simplify leaves them.
+func (x *expander) build(s sum) Expression {
+	var keys []string
+	for k := range s {
+		keys = append(keys, k)
+	}
+	// constant first, then by total degree
+	degree := func(k string) int {
+		d := 0
+		for _, n := range s[k].powers {
+			d += n
+		}
+		return d
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if (a == "") != (b == "") {
+			return a == ""
+		}
+		if da, db := degree(a), degree(b); da != db {
+			return da < db
+		}
+		return a < b
+	})
+	var summands []Expression
+	for _, k := range keys {
+		summands = append(summands, x.buildProduct(s[k]))
+	}
+	if len(summands) == 0 {
+		return Num{0.}
+	}
+	z := summands[len(summands)-1]
+	for i := len(summands) - 2; i >= 0; i-- {
+		z = Add{summands[i], z}
+	}
+	return z
+}
+
+func (x *expander) buildProduct(p product) Expression {
+	var mlist []Expression
+	if !almostEqual(p.coef, 1.) || len(p.powers) == 0 {
+		mlist = append(mlist, Num{p.coef})
+	}
+	for _, k := range sortedPowers(p.powers) {
+		if n := p.powers[k]; n != 1 {
+			mlist = append(mlist, Pow{x.atoms[k], float64(n)})
+			continue
+		}
+		mlist = append(mlist, x.atoms[k])
+	}
+	z := mlist[len(mlist)-1]
+	for i := len(mlist) - 2; i >= 0; i-- {
+		z = Mul{mlist[i], z}
+	}
+	return z
+}
+
+// Expand distributes every product and integer
+// power in e, e.g. (x+1)^3 becomes 1+3x+3x^2+x^3,
+// and combines like terms. Anything that isn't
+// polynomial, like Sin(x), is kept as an opaque
+// factor with its argument expanded.
+func Expand(e Expression) Expression {
+	x := &expander{make(map[string]Expression)}
+	return x.build(x.expand(e))
+}
+
+// Collect expands e and groups its terms by powers
+// of v, highest first, so the result reads as a
+// polynomial in v with expression coefficients.
+// Occurrences of v inside opaque factors such as
+// Sin(v) stay in the coefficients.
+func Collect(e Expression, v Var) Expression {
+	x := &expander{make(map[string]Expression)}
+	s := x.expand(e)
+	key := atomKey(v)
+
+	groups := make(map[int]sum)
+	for _, p := range s {
+		n := p.powers[key]
+		rest := make(map[string]int)
+		for a, m := range p.powers {
+			if a != key {
+				rest[a] = m
+			}
+		}
+		if groups[n] == nil {
+			groups[n] = make(sum)
+		}
+		groups[n] = groups[n].add(single(product{p.coef, rest}))
+	}
+	var powers []int
+	for n := range groups {
+		powers = append(powers, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(powers)))
+
+	var summands []Expression
+	for _, n := range powers {
+		coef := x.build(groups[n])
+		var term Expression
+		switch n {
+		case 0:
+			term = coef
+		case 1:
+			term = v
+		default:
+			term = Pow{v, float64(n)}
+		}
+		if n != 0 && !isTypeEqualToFloat(coef, 1.) {
+			term = Mul{coef, term}
+		}
+		summands = append(summands, term)
+	}
+	if len(summands) == 0 {
+		return Num{0.}
+	}
+	z := summands[len(summands)-1]
+	for i := len(summands) - 2; i >= 0; i-- {
+		z = Add{summands[i], z}
+	}
+	return z
+}
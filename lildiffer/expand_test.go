@@ -0,0 +1,105 @@
+package lildiffer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	type ptype map[string]float64
+	x, y := Var{"x"}, Var{"y"}
+	table := []struct {
+		description string
+		f           Expression
+		expanded    Expression
+	}{
+		{"(x+1)^3",
+			Pow{Add{x, Num{1.}}, 3.},
+			Add{Num{1.}, Add{Mul{Num{3.}, x},
+				Add{Mul{Num{3.}, Pow{x, 2.}}, Pow{x, 3.}}}},
+		},
+		{"(x+y)(x-y)",
+			Mul{Add{x, y}, Add{x, Mul{Num{-1.}, y}}},
+			Add{Pow{x, 2.}, Mul{Num{-1.}, Pow{y, 2.}}},
+		},
+		{"Sin(x) * (x + Sin(x))",
+			Mul{Sin{x}, Add{x, Sin{x}}},
+			Add{Mul{Sin{x}, x}, Pow{Sin{x}, 2.}},
+		},
+		{"Cos(x(1+x)) is opaque with its argument expanded",
+			Mul{Num{2.}, Cos{Mul{x, Add{Num{1.}, x}}}},
+			Mul{Num{2.}, Cos{Add{x, Pow{x, 2.}}}},
+		},
+		{"(x+1)/x",
+			Div{Add{x, Num{1.}}, x},
+			Add{Num{1.}, Pow{x, -1.}},
+		},
+		{"x/(x+1) + 1/(x+1)",
+			Add{Div{x, Add{x, Num{1.}}}, Div{Num{1.}, Add{Num{1.}, x}}},
+			Add{Pow{Add{Num{1.}, x}, -1.}, Mul{Pow{Add{Num{1.}, x}, -1.}, x}},
+		},
+		{"poly times sum",
+			Mul{newPoly(ptype{"xy": 2}), Add{x, Num{-1.}}},
+			Add{Mul{Num{-2.}, Mul{x, y}}, Mul{Num{2.}, Mul{Pow{x, 2.}, y}}},
+		},
+		{"x - x",
+			Add{x, Mul{Num{-1.}, x}},
+			Num{0.},
+		},
+		{"x/0 keeps 0 as a factor",
+			Div{x, Num{0.}},
+			Mul{Pow{Num{0.}, -1.}, x},
+		},
+		{"x^1000000 * x",
+			Mul{Pow{x, 1e6}, x},
+			Pow{x, 1000001.},
+		},
+		{"(x+1)^100000 stays whole",
+			Pow{Add{x, Num{1.}}, 1e5},
+			Pow{Add{Num{1.}, x}, 100000.},
+		},
+		{"small coefficients stay",
+			Add{Mul{Num{1e-12}, x}, Mul{Num{3e-13}, x}},
+			Mul{Num{1.3e-12}, x},
+		},
+	}
+	for _, tt := range table {
+		if got := Expand(tt.f); !reflect.DeepEqual(got, tt.expanded) {
+			t.Errorf("Expand %v\ngot  %v\nwant %v", tt.description, Read(got), Read(tt.expanded))
+		}
+	}
+	// a variable named like a function is
+	// a different factor from the function
+	odd := Var{"Sin(x)"}
+	if got := Expand(Add{odd, Sin{x}}); reflect.DeepEqual(got, Mul{Num{2.}, Sin{x}}) ||
+		reflect.DeepEqual(got, Mul{Num{2.}, odd}) {
+		t.Errorf("Expand merged %v and Sin(x): %#v", odd.Name, got)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	x, a, b := Var{"x"}, Var{"a"}, Var{"b"}
+	table := []struct {
+		description string
+		f           Expression
+		collected   Expression
+	}{
+		{"a x + b x + (a x)^2 + 3",
+			Add{Add{Mul{a, x}, Mul{b, x}}, Add{Pow{Mul{a, x}, 2.}, Num{3.}}},
+			Add{Mul{Pow{a, 2.}, Pow{x, 2.}}, Add{Mul{Add{a, b}, x}, Num{3.}}},
+		},
+		{"derivative of x^2 Sin(x)",
+			Derive(Mul{Pow{x, 2.}, Sin{x}}),
+			Add{Mul{Cos{x}, Pow{x, 2.}}, Mul{Mul{Num{2.}, Sin{x}}, x}},
+		},
+		{"(x+1)^2",
+			Pow{Add{x, Num{1.}}, 2.},
+			Add{Pow{x, 2.}, Add{Mul{Num{2.}, x}, Num{1.}}},
+		},
+	}
+	for _, tt := range table {
+		if got := Collect(tt.f, x); !reflect.DeepEqual(got, tt.collected) {
+			t.Errorf("Collect %v\ngot  %v\nwant %v", tt.description, Read(got), Read(tt.collected))
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package lildiffer
+
+import (
+	"math/big"
+	"sort"
+)
+
+// A PolyFactor is a factor of a polynomial
+// together with its multiplicity. A monomial
+// factor like x has a negative one when p
+// holds negative powers of it.
+type PolyFactor struct {
+	P            RatPoly
+	Multiplicity int
+}
+
+// dense univariate polynomial over the rationals,
+// constant term first, no trailing zeros
+type upoly []*big.Rat
+
+func trim(p upoly) upoly {
+	for len(p) > 0 && p[len(p)-1].Sign() == 0 {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// degree of the zero polynomial is -1
+func (p upoly) deg() int {
+	return len(p) - 1
+}
+
+func (p upoly) lead() *big.Rat {
+	return p[len(p)-1]
+}
+
+func umul(a, b upoly) upoly {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	r := make(upoly, len(a)+len(b)-1)
+	for i := range r {
+		r[i] = new(big.Rat)
+	}
+	t := new(big.Rat)
+	for i, x := range a {
+		for j, y := range b {
+			r[i+j].Add(r[i+j], t.Mul(x, y))
+		}
+	}
+	return trim(r)
+}
+
+// udivmod returns q, r with a = q*b + r
+func udivmod(a, b upoly) (upoly, upoly) {
+	r := make(upoly, len(a))
+	for i, c := range a {
+		r[i] = new(big.Rat).Set(c)
+	}
+	if a.deg() < b.deg() {
+		return nil, r
+	}
+	q := make(upoly, a.deg()-b.deg()+1)
+	for i := range q {
+		q[i] = new(big.Rat)
+	}
+	t := new(big.Rat)
+	for r.deg() >= b.deg() {
+		shift := r.deg() - b.deg()
+		c := new(big.Rat).Quo(r.lead(), b.lead())
+		q[shift] = c
+		for i, bc := range b {
+			r[i+shift].Sub(r[i+shift], t.Mul(c, bc))
+		}
+		// the leading term cancels exactly
+		r = trim(r[:len(r)-1])
+	}
+	return trim(q), r
+}
+
+func umonic(p upoly) upoly {
+	if len(p) == 0 {
+		return p
+	}
+	inv := new(big.Rat).Inv(p.lead())
+	r := make(upoly, len(p))
+	for i, c := range p {
+		r[i] = new(big.Rat).Mul(c, inv)
+	}
+	return r
+}
+
+// monic greatest common divisor
+func ugcd(a, b upoly) upoly {
+	for len(b) > 0 {
+		_, r := udivmod(a, b)
+		a, b = b, r
+	}
+	return umonic(a)
+}
+
+func uderiv(p upoly) upoly {
+	if len(p) <= 1 {
+		return nil
+	}
+	r := make(upoly, len(p)-1)
+	for i := range r {
+		r[i] = new(big.Rat).Mul(p[i+1], big.NewRat(int64(i+1), 1))
+	}
+	return trim(r)
+}
+
+func ueval(p upoly, x *big.Rat) *big.Rat {
+	r := new(big.Rat)
+	for i := len(p) - 1; i >= 0; i-- {
+		r.Mul(r, x)
+		r.Add(r, p[i])
+	}
+	return r
+}
+
+// primitive scales p to integer coefficients with
+// no common divisor and a positive leading term.
+// It returns the scaled polynomial and the content
+// c with p = c * primitive.
+func primitive(p upoly) (upoly, *big.Rat) {
+	if len(p) == 0 {
+		return p, new(big.Rat)
+	}
+	den := big.NewInt(1)
+	num := new(big.Int)
+	g := new(big.Int)
+	for _, c := range p {
+		g.GCD(nil, nil, den, c.Denom())
+		den.Mul(den, c.Denom())
+		den.Quo(den, g)
+		num.GCD(nil, nil, num, new(big.Int).Abs(c.Num()))
+	}
+	content := new(big.Rat).SetFrac(num, den)
+	if p.lead().Sign() < 0 {
+		content.Neg(content)
+	}
+	r := make(upoly, len(p))
+	for i, c := range p {
+		r[i] = new(big.Rat).Quo(c, content)
+	}
+	return r, content
+}
+
+// squareFree splits p by Yun's algorithm into
+// monic square free parts, where part i has
+// multiplicity i+1. Parts may be 1.
+func squareFree(p upoly) []upoly {
+	var parts []upoly
+	c := ugcd(p, uderiv(p))
+	w, _ := udivmod(p, c)
+	for c.deg() > 0 {
+		y := ugcd(w, c)
+		z, _ := udivmod(w, y)
+		parts = append(parts, umonic(z))
+		w = y
+		c, _ = udivmod(c, y)
+	}
+	return append(parts, umonic(w))
+}
+
+// positive divisors of n, or nil when n is too
+// large to be worth trial division
+func divisors(n *big.Int) []int64 {
+	if !n.IsInt64() {
+		return nil
+	}
+	v := n.Int64()
+	if v < 0 {
+		v = -v
+	}
+	if v > 1e12 {
+		return nil
+	}
+	var small, large []int64
+	for d := int64(1); d*d <= v; d++ {
+		if v%d == 0 {
+			small = append(small, d)
+			if d*d != v {
+				large = append([]int64{v / d}, large...)
+			}
+		}
+	}
+	return append(small, large...)
+}
+
+// interpolate the polynomial through (xs[i], ys[i])
+// by Newton's divided differences.
+func interpolate(xs []int64, ys []*big.Rat) upoly {
+	n := len(xs)
+	dd := make([]*big.Rat, n)
+	for i := range ys {
+		dd[i] = new(big.Rat).Set(ys[i])
+	}
+	for j := 1; j < n; j++ {
+		for i := n - 1; i >= j; i-- {
+			dd[i].Sub(dd[i], dd[i-1])
+			dd[i].Quo(dd[i], big.NewRat(xs[i]-xs[i-j], 1))
+		}
+	}
+	// expand the Newton form, innermost first
+	r := upoly{new(big.Rat).Set(dd[n-1])}
+	for i := n - 2; i >= 0; i-- {
+		r = umul(r, upoly{big.NewRat(-xs[i], 1), big.NewRat(1, 1)})
+		if len(r) == 0 {
+			r = upoly{new(big.Rat)}
+		}
+		r[0].Add(r[0], dd[i])
+	}
+	return trim(r)
+}
+
+func isIntegral(p upoly) bool {
+	for _, c := range p {
+		if !c.IsInt() {
+			return false
+		}
+	}
+	return true
+}
+
+// kroneckerFactor searches for a factor of degree d
+// of the primitive integer polynomial f. Any factor
+// takes values dividing f's values, so we try every
+// combination of divisors at d+1 sample points and
+// interpolate.
+func kroneckerFactor(f upoly, d int) upoly {
+	type sample struct {
+		x    int64
+		divs []int64
+	}
+	var samples []sample
+	for i := 0; i < 4*f.deg()+8; i++ {
+		// 0, 1, -1, 2, -2, ...
+		x := int64((i + 1) / 2)
+		if i%2 == 0 {
+			x = -x
+		}
+		v := ueval(f, big.NewRat(x, 1))
+		if v.Sign() == 0 {
+			return upoly{big.NewRat(-x, 1), big.NewRat(1, 1)}
+		}
+		if divs := divisors(v.Num()); divs != nil {
+			samples = append(samples, sample{x, divs})
+		}
+	}
+	if len(samples) < d+1 {
+		return nil
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return len(samples[i].divs) < len(samples[j].divs)
+	})
+	samples = samples[:d+1]
+
+	xs := make([]int64, d+1)
+	ys := make([]*big.Rat, d+1)
+	for i, s := range samples {
+		xs[i] = s.x
+	}
+	var search func(i int) upoly
+	search = func(i int) upoly {
+		if i == len(samples) {
+			g := interpolate(xs, ys)
+			if g.deg() != d || !isIntegral(g) {
+				return nil
+			}
+			if _, r := udivmod(f, g); len(r) != 0 {
+				return nil
+			}
+			return g
+		}
+		for _, dv := range samples[i].divs {
+			for _, sign := range []int64{1, -1} {
+				// g and -g are the same factor, so
+				// fix the sign of the first value
+				if i == 0 && sign < 0 {
+					continue
+				}
+				ys[i] = big.NewRat(sign*dv, 1)
+				if g := search(i + 1); g != nil {
+					return g
+				}
+			}
+		}
+		return nil
+	}
+	return search(0)
+}
+
+// kronecker splits a primitive square free integer
+// polynomial into irreducible factors over the
+// integers. Exponential in the degree, so meant
+// for the small polynomials we meet in practice.
+func kronecker(f upoly) []upoly {
+	for d := 1; d <= f.deg()/2; d++ {
+		if g := kroneckerFactor(f, d); g != nil {
+			g, _ = primitive(g)
+			q, _ := udivmod(f, g)
+			q, _ = primitive(q)
+			// the smallest factor is irreducible
+			return append([]upoly{g}, kronecker(q)...)
+		}
+	}
+	return []upoly{f}
+}
+
+func toUpoly(p RatPoly, name string) upoly {
+	var r upoly
+	for key, value := range p.terms {
+		n := 0
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			if m == name {
+				n += exponents[i]
+			}
+		}
+		for len(r) <= n {
+			r = append(r, new(big.Rat))
+		}
+		r[n].Add(r[n], value)
+	}
+	return trim(r)
+}
+
+func fromUpoly(p upoly, name string) RatPoly {
+	m := make(map[string]*big.Rat)
+	for i, c := range p {
+		if c.Sign() == 0 {
+			continue
+		}
+		key := ""
+		if i > 0 {
+			key = makePolyTerm([]string{name}, []int{i})
+		}
+		m[key] = new(big.Rat).Set(c)
+	}
+	return RatPoly{m}
+}
+
+// FactorPoly factors p over the rationals into a
+// rational constant and primitive integer factors
+// with positive leading coefficients.
+//
+// Univariate polynomials (after pulling out a common
+// monomial) are split completely into irreducibles.
+// A genuinely multivariate cofactor is only made
+// primitive and returned as a single factor.
+func FactorPoly(p RatPoly) (*big.Rat, []PolyFactor) {
+	return factorPoly(p, true)
+}
+
+// SquareFree is like FactorPoly but only separates
+// factors by multiplicity; each returned factor is
+// square free but not necessarily irreducible.
+func SquareFree(p RatPoly) (*big.Rat, []PolyFactor) {
+	return factorPoly(p, false)
+}
+
+func factorPoly(p RatPoly, full bool) (*big.Rat, []PolyFactor) {
+	if p.IsZero() {
+		return new(big.Rat), nil
+	}
+	powers, rest, vars := monomialContent(p)
+	var factors []PolyFactor
+	for _, m := range sortedPowers(powers) {
+		factors = append(factors, PolyFactor{
+			fromUpoly(upoly{new(big.Rat), big.NewRat(1, 1)}, m),
+			powers[m],
+		})
+	}
+
+	switch len(vars) {
+	case 0:
+		return rest.Coefficient(""), factors
+	case 1:
+		name := vars[0]
+		u, content := primitive(toUpoly(rest, name))
+		for i, part := range squareFree(u) {
+			if part.deg() < 1 {
+				continue
+			}
+			part, _ = primitive(part)
+			pieces := []upoly{part}
+			if full {
+				pieces = kronecker(part)
+			}
+			for _, f := range pieces {
+				factors = append(factors, PolyFactor{fromUpoly(f, name), i + 1})
+			}
+		}
+		return content, factors
+	}
+
+	// multivariate: pull out the numeric content only
+	c := ratContent(rest)
+	factors = append(factors, PolyFactor{ScaleRat(rest, new(big.Rat).Inv(c)), 1})
+	return c, factors
+}
+
+// ratContent is the signed rational by which p must
+// be divided to leave coprime integer coefficients
+// and a positive coefficient on the first key.
+func ratContent(p RatPoly) *big.Rat {
+	num := new(big.Int)
+	den := big.NewInt(1)
+	g := new(big.Int)
+	for _, value := range p.terms {
+		num.GCD(nil, nil, num, new(big.Int).Abs(value.Num()))
+		g.GCD(nil, nil, den, value.Denom())
+		den.Mul(den, value.Denom())
+		den.Quo(den, g)
+	}
+	c := new(big.Rat).SetFrac(num, den)
+	if keys := sortedRatKeys(p.terms); p.terms[keys[0]].Sign() < 0 {
+		c.Neg(c)
+	}
+	return c
+}
+
+// monomialContent pulls out the largest monomial
+// dividing every term of p. It returns that
+// monomial's powers, the cofactor, and the variables
+// left in the cofactor.
+func monomialContent(p RatPoly) (map[string]int, RatPoly, []string) {
+	// a variable missing from a term has power 0
+	// there, so the minimum runs over all of them
+	var terms []map[string]int
+	powers := make(map[string]int)
+	for key := range p.terms {
+		m := make(map[string]int)
+		monomials, exponents := decomposePoly(key)
+		for i, s := range monomials {
+			m[s] += exponents[i]
+		}
+		terms = append(terms, m)
+		for s := range m {
+			powers[s] = m[s]
+		}
+	}
+	for _, m := range terms {
+		for s := range powers {
+			if m[s] < powers[s] {
+				powers[s] = m[s]
+			}
+		}
+	}
+	for s, e := range powers {
+		if e == 0 {
+			delete(powers, s)
+		}
+	}
+
+	rest := make(map[string]*big.Rat)
+	seen := make(map[string]bool)
+	var vars []string
+	for key, value := range p.terms {
+		var ms []string
+		var es []int
+		monomials, exponents := decomposePoly(key)
+		m := make(map[string]int)
+		for i, s := range monomials {
+			m[s] += exponents[i]
+		}
+		// negative powers pulled out leave
+		// powers of variables m lacks
+		for s := range powers {
+			m[s] += 0
+		}
+		for _, s := range sortedPowers(m) {
+			if e := m[s] - powers[s]; e != 0 {
+				ms = append(ms, s)
+				es = append(es, e)
+				if !seen[s] {
+					seen[s] = true
+					vars = append(vars, s)
+				}
+			}
+		}
+		rest[makePolyTerm(ms, es)] = new(big.Rat).Set(value)
+	}
+	sort.Strings(vars)
+	return powers, RatPoly{rest}, vars
+}
+
+// sortedKeys lists the monomials of
+// a Poly's terms in order
+func sortedKeys(m map[string]float64) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedRatKeys is sortedKeys for a RatPoly
+func sortedRatKeys(m map[string]*big.Rat) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedPowers lists the indeterminates
+// of a map of exponents in order
+func sortedPowers(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Factor rewrites the polynomial parts of e as
+// products of their factors, e.g. z^2-4z+4
+// becomes (z-2)^2.
+func Factor(e Expression) Expression {
+	before := func(ex Expression) (Expression, bool) {
+		return ex, true
+	}
+	after := func(e Expression) Expression {
+		p, ok := e.(Poly)
+		if !ok {
+			return e
+		}
+		c, factors := FactorPoly(ToRatPoly(p))
+		f, _ := c.Float64()
+		var mlist []Expression
+		if !almostEqual(f, 1.) || len(factors) == 0 {
+			mlist = append(mlist, Num{f})
+		}
+		for _, pf := range factors {
+			var base Expression = pf.P.Poly()
+			if len(pf.P.terms) == 1 {
+				// a bare variable reads better as a Var
+				for key := range pf.P.terms {
+					base = indeterminate(key)
+				}
+			}
+			if pf.Multiplicity == 1 {
+				mlist = append(mlist, base)
+				continue
+			}
+			mlist = append(mlist, Pow{base, float64(pf.Multiplicity)})
+		}
+		z := mlist[len(mlist)-1]
+		for i := len(mlist) - 2; i >= 0; i-- {
+			z = Mul{mlist[i], z}
+		}
+		return z
+	}
+	return GenericParse(before, after, makePoly(Simplify(e)))
+}
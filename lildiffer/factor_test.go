@@ -0,0 +1,147 @@
+package lildiffer
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestFactorPoly(t *testing.T) {
+	type ptype map[string]float64
+	type ftype struct {
+		p ptype
+		m int
+	}
+	table := []struct {
+		description string
+		p           ptype
+		content     *big.Rat
+		factors     []ftype
+	}{
+		{"z^2-4z+4",
+			ptype{"z^2": 1, "z": -4, "": 4},
+			big.NewRat(1, 1),
+			[]ftype{{ptype{"z": 1, "": -2}, 2}},
+		},
+		{"x^4-1",
+			ptype{"x^4": 1, "": -1},
+			big.NewRat(1, 1),
+			[]ftype{
+				{ptype{"x": 1, "": -1}, 1},
+				{ptype{"x": 1, "": 1}, 1},
+				{ptype{"x^2": 1, "": 1}, 1},
+			},
+		},
+		{"x^5+x+1",
+			ptype{"x^5": 1, "x": 1, "": 1},
+			big.NewRat(1, 1),
+			[]ftype{
+				{ptype{"x^2": 1, "x": 1, "": 1}, 1},
+				{ptype{"x^3": 1, "x^2": -1, "": 1}, 1},
+			},
+		},
+		{"x^4+1 is irreducible",
+			ptype{"x^4": 1, "": 1},
+			big.NewRat(1, 1),
+			[]ftype{{ptype{"x^4": 1, "": 1}, 1}},
+		},
+		{"-3x^3/2 + 3x^2/2",
+			ptype{"x^3": -1.5, "x^2": 1.5},
+			big.NewRat(-3, 2),
+			[]ftype{
+				{ptype{"x": 1}, 2},
+				{ptype{"x": 1, "": -1}, 1},
+			},
+		},
+		{"4y^2-1",
+			ptype{"y^2": 4, "": -1},
+			big.NewRat(1, 1),
+			[]ftype{
+				{ptype{"y": 2, "": -1}, 1},
+				{ptype{"y": 2, "": 1}, 1},
+			},
+		},
+		{"1 + x^-1",
+			ptype{"": 1, "x^-1": 1},
+			big.NewRat(1, 1),
+			[]ftype{
+				{ptype{"x": 1}, -1},
+				{ptype{"x": 1, "": 1}, 1},
+			},
+		},
+		{"y^-2x + x^3y",
+			ptype{"y^-2x": 1, "x^3y": 1},
+			big.NewRat(1, 1),
+			[]ftype{
+				{ptype{"x": 1}, 1},
+				{ptype{"y": 1}, -2},
+				{ptype{"x^2y^3": 1, "": 1}, 1},
+			},
+		},
+		{"x^2y - y multivariate content",
+			ptype{"x^2y": 1, "y": -1},
+			big.NewRat(1, 1),
+			[]ftype{
+				{ptype{"y": 1}, 1},
+				{ptype{"x": 1, "": -1}, 1},
+				{ptype{"x": 1, "": 1}, 1},
+			},
+		},
+	}
+	for _, tt := range table {
+		c, factors := FactorPoly(ToRatPoly(newPoly(tt.p)))
+		var got, want []ftype
+		for _, f := range factors {
+			got = append(got, ftype{f.P.Poly().terms, f.Multiplicity})
+		}
+		for _, f := range tt.factors {
+			want = append(want, ftype{newPoly(f.p).terms, f.m})
+		}
+		if c.Cmp(tt.content) != 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("FactorPoly %v\ngot  %v %v\nwant %v %v",
+				tt.description, c, got, tt.content, want)
+		}
+	}
+}
+
+func TestSquareFree(t *testing.T) {
+	type ptype map[string]float64
+	// (x-1)(x+1)^2(x^2+1)^3 expanded
+	q := mul(mul(newPoly(ptype{"x": 1, "": -1}), newPoly(ptype{"x": 1, "": 1})),
+		newPoly(ptype{"x": 1, "": 1}))
+	for i := 0; i < 3; i++ {
+		q = mul(q, newPoly(ptype{"x^2": 1, "": 1}))
+	}
+	c, factors := SquareFree(ToRatPoly(q))
+	want := []PolyFactor{
+		{ToRatPoly(newPoly(ptype{"x": 1, "": -1})), 1},
+		{ToRatPoly(newPoly(ptype{"x": 1, "": 1})), 2},
+		{ToRatPoly(newPoly(ptype{"x^2": 1, "": 1})), 3},
+	}
+	if c.Cmp(big.NewRat(1, 1)) != 0 || len(factors) != len(want) {
+		t.Fatalf("SquareFree got %v %v", c, factors)
+	}
+	for i := range want {
+		if !factors[i].P.Equal(want[i].P) || factors[i].Multiplicity != want[i].Multiplicity {
+			t.Errorf("SquareFree factor %v got %v^%v, want %v^%v", i,
+				factors[i].P, factors[i].Multiplicity, want[i].P, want[i].Multiplicity)
+		}
+	}
+}
+
+func TestFactor(t *testing.T) {
+	type ptype map[string]float64
+	z := Var{"z"}
+	// denominator of the quotient rule example in TestDerive
+	e := Div{Num{15.}, Mul{Add{Num{2.}, Mul{Num{-1.}, z}}, Add{Num{2.}, Mul{Num{-1.}, z}}}}
+	want := Div{Num{15.}, Pow{newPoly(ptype{"z": 1, "": -2}), 2.}}
+	if got := Factor(e); !reflect.DeepEqual(got, want) {
+		t.Errorf("Factor got %v, want %v", Read(got), Read(want))
+	}
+
+	got := Factor(Sin{Mul{Num{2.}, Mul{z, Add{z, Num{-1.}}}}})
+	want2 := Sin{Mul{Num{2.}, Mul{z, newPoly(ptype{"z": 1, "": -1})}}}
+	if !reflect.DeepEqual(got, want2) {
+		t.Errorf("Factor got %v, want %v", Read(got), Read(want2))
+	}
+}
@@ -0,0 +1,146 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// A FitResult is the outcome of CurveFit.
+type FitResult struct {
+	// Params binds the parameters
+	Params map[string]float64
+	// Covariance of the parameters, in the order
+	// given, scaled by the residual variance.
+	// Nil when the Jacobian is rank deficient
+	// or there are no spare data points.
+	Covariance [][]float64
+	// Residual is the sum of squared residuals
+	Residual   float64
+	Iterations int
+	Converged  bool
+}
+
+// CurveFit fits model, a function of x and params, to the
+// points (xs[i], ys[i]) by Levenberg-Marquardt. start gives
+// the initial parameters and binds any other variables of
+// model. The Jacobian of the residuals comes from
+// PartialDerive on model in each parameter. It stops once a
+// step lowers the sum of squared residuals by less than tol
+// relative to it, or after maxIter steps. If no step lowers
+// it at all, it stops early, converged only if the gradient
+// Jᵀr is below tol relative to the sizes of J and r.
+func CurveFit(model Expression, params []Var, x Var, xs, ys []float64, start map[string]float64, tol float64, maxIter int) FitResult {
+	if len(xs) != len(ys) {
+		panic("CurveFit needs as many ys as xs")
+	}
+	grad := Gradient(model, params)
+	env := make(map[string]float64, len(start)+1)
+	for k, v := range start {
+		env[k] = v
+	}
+	p := make([]float64, len(params))
+	for i, v := range params {
+		p[i] = start[v.Name]
+	}
+	bind := func(p []float64) {
+		for i, v := range params {
+			env[v.Name] = p[i]
+		}
+	}
+	ssr := func(p []float64) float64 {
+		bind(p)
+		s := 0.
+		for i := range xs {
+			env[x.Name] = xs[i]
+			r := Eval(model, env) - ys[i]
+			s += r * r
+		}
+		return s
+	}
+	// JᵀJ and Jᵀr at p
+	normal := func(p []float64) ([][]float64, []float64) {
+		bind(p)
+		j := make([][]float64, len(xs))
+		r := make([]float64, len(xs))
+		for i := range xs {
+			env[x.Name] = xs[i]
+			r[i] = Eval(model, env) - ys[i]
+			j[i] = make([]float64, len(params))
+			for k, g := range grad {
+				j[i][k] = Eval(g, env)
+			}
+		}
+		return normalEquations(j, r, 0)
+	}
+
+	s := ssr(p)
+	mu := 1e-3
+	iter := 0
+	converged, stuck := false, false
+	for ; iter < maxIter && !converged && !stuck; iter++ {
+		a, b := normal(p)
+		// raise the damping until a step helps
+		for {
+			damped := make([][]float64, len(a))
+			for i := range a {
+				damped[i] = append([]float64(nil), a[i]...)
+				damped[i][i] += mu * math.Max(a[i][i], 1e-12)
+			}
+			dp, err := solveDense(damped, b)
+			if err == nil {
+				next := axpy(p, 1, dp)
+				if ns := ssr(next); ns <= s {
+					converged = s-ns <= tol*s || norm2(dp) <= tol*(norm2(p)+tol)
+					p, s = next, ns
+					mu = math.Max(mu/10, 1e-12)
+					break
+				}
+			}
+			mu *= 10
+			if mu > 1e12 {
+				// no step helps, which at a minimum is
+				// just rounding; anywhere else give up
+				trace := 0.
+				for i := range a {
+					trace += a[i][i]
+				}
+				converged = norm2(b) <= tol*math.Sqrt(trace*s)
+				stuck = !converged
+				break
+			}
+		}
+	}
+
+	bind(p)
+	fitted := make(map[string]float64, len(params))
+	for _, v := range params {
+		fitted[v.Name] = env[v.Name]
+	}
+	return FitResult{fitted, covariance(normal, p, s, len(xs)), s, iter, converged}
+}
+
+// covariance is s²(JᵀJ)⁻¹ with s² the residual
+// variance, ssr over the degrees of freedom
+func covariance(normal func([]float64) ([][]float64, []float64), p []float64, ssr float64, n int) [][]float64 {
+	dof := n - len(p)
+	if dof <= 0 {
+		return nil
+	}
+	a, _ := normal(p)
+	sigma2 := ssr / float64(dof)
+	c := make([][]float64, len(p))
+	for i := range c {
+		c[i] = make([]float64, len(p))
+	}
+	for k := range p {
+		e := make([]float64, len(p))
+		e[k] = 1
+		col, err := solveDense(a, e)
+		if err != nil {
+			return nil
+		}
+		for i := range col {
+			c[i][k] = sigma2 * col[i]
+		}
+	}
+	return c
+}
@@ -0,0 +1,89 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCurveFit(t *testing.T) {
+	x, a, b, c := Var{"x"}, Var{"a"}, Var{"b"}, Var{"c"}
+
+	// a Sin(b x + c) through exact samples
+	model := Mul{a, Sin{Add{Mul{b, x}, c}}}
+	var xs, ys []float64
+	for i := 0; i < 40; i++ {
+		xi := float64(i) / 8
+		xs = append(xs, xi)
+		ys = append(ys, 2*math.Sin(1.5*xi+.3))
+	}
+	r := CurveFit(model, []Var{a, b, c}, x, xs, ys,
+		map[string]float64{"a": 1.5, "b": 1.3, "c": 0}, 1e-14, 200)
+	want := map[string]float64{"a": 2, "b": 1.5, "c": .3}
+	if !r.Converged || r.Residual > 1e-18 {
+		t.Errorf("CurveFit sine didn't converge: %+v", r)
+	}
+	for name, w := range want {
+		if math.Abs(r.Params[name]-w) > 1e-8 {
+			t.Errorf("CurveFit sine got %v = %v, want %v", name, r.Params[name], w)
+		}
+	}
+
+	// a straight line through noisy points,
+	// checked against ordinary least squares
+	line := Add{Mul{a, x}, b}
+	xs = []float64{0, 1, 2, 3, 4, 5}
+	ys = []float64{1.1, 2.9, 5.2, 6.8, 9.1, 11.0}
+	r = CurveFit(line, []Var{a, b}, x, xs, ys, map[string]float64{"a": 0, "b": 0}, 1e-14, 100)
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	det := n*sxx - sx*sx
+	slope := (n*sxy - sx*sy) / det
+	intercept := (sy - slope*sx) / n
+	ssr := 0.
+	for i := range xs {
+		e := slope*xs[i] + intercept - ys[i]
+		ssr += e * e
+	}
+	sigma2 := ssr / (n - 2)
+	if !r.Converged {
+		t.Errorf("CurveFit line didn't converge: %+v", r)
+	}
+	if math.Abs(r.Params["a"]-slope) > 1e-9 || math.Abs(r.Params["b"]-intercept) > 1e-9 {
+		t.Errorf("CurveFit line got %v, want a = %v, b = %v", r.Params, slope, intercept)
+	}
+	if !almostEqual(r.Residual, ssr) {
+		t.Errorf("CurveFit line residual got %v, want %v", r.Residual, ssr)
+	}
+	wantCov := [][]float64{
+		{sigma2 * n / det, -sigma2 * sx / det},
+		{-sigma2 * sx / det, sigma2 * sxx / det},
+	}
+	for i := range wantCov {
+		for j := range wantCov[i] {
+			if !almostEqual(r.Covariance[i][j], wantCov[i][j]) {
+				t.Errorf("CurveFit covariance got %v, want %v", r.Covariance, wantCov)
+			}
+		}
+	}
+
+	// as many parameters as points leaves
+	// no residual variance
+	r = CurveFit(line, []Var{a, b}, x, []float64{0, 1}, []float64{1, 3},
+		map[string]float64{"a": 0, "b": 0}, 1e-14, 100)
+	if !r.Converged || r.Covariance != nil || !almostEqual(r.Params["a"], 2) {
+		t.Errorf("CurveFit two points got %+v", r)
+	}
+	// at a = 0 the slope of Sqrt(a) blows up, so no
+	// step helps though a = 4 fits exactly
+	r = CurveFit(Mul{Pow{a, .5}, x}, []Var{a}, x, xs, []float64{0, 2, 4, 6, 8, 10},
+		map[string]float64{"a": 0}, 1e-14, 100)
+	if r.Converged || r.Params["a"] != 0 || r.Iterations != 1 {
+		t.Errorf("CurveFit stuck at a = 0 got %+v", r)
+	}
+}
@@ -0,0 +1,426 @@
+//go:build go1.18
+// +build go1.18
+
+// testing.F arrived in Go 1.18, the rest
+// of the package builds with Go 1.10.
+
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Fuzz inputs are expression trees in prefix order.
+// Each node is a tag byte followed by its operands:
+//
+//	Num    int16 little endian, in quarters
+//	Var    index into fuzzVars
+//	Poly   term count, then per term a Num coefficient,
+//	       a factor count and per factor a Var and int8 exponent
+//	Pow    int8 exponent in quarters, then the base
+//	others their children
+//
+// Running out of input reads zeros, which decode
+// as Num{0}, so every byte string is a tree.
+const (
+	tagNum = iota
+	tagVar
+	tagPoly
+	tagAdd
+	tagMul
+	tagDiv
+	tagPow
+	tagSin
+	tagCos
+	tagCon
+	tags
+)
+
+// theta is multi-letter, so it
+// turns into a bracketed poly atom
+var fuzzVars = []Var{{"a"}, {"b"}, {"c"}, {"m"}, {"n"}, {"x"}, {"y"}, {"z"}, {"theta"}}
+
+// fuzzEnv binds every fuzz variable away from
+// 0 and 1, where mistakes tend to cancel out
+var fuzzEnv = map[string]float64{
+	"a": .5, "b": -1.3, "c": 2, "m": .7, "n": -.4,
+	"x": .3, "y": -.7, "z": 1.1, "theta": .9,
+}
+
+// decoding caps tree depth, and the product of
+// exponents along a path, so polynomial expansion
+// stays small enough to fuzz quickly
+const (
+	maxFuzzDepth = 12
+	maxFuzzPower = 32
+)
+
+type decoder struct {
+	b     []byte
+	power float64
+}
+
+func (d *decoder) byte() byte {
+	if len(d.b) == 0 {
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) num() float64 {
+	lo := d.byte()
+	hi := d.byte()
+	return float64(int16(uint16(lo)|uint16(hi)<<8)) / 4
+}
+
+func (d *decoder) variable() Var {
+	return fuzzVars[int(d.byte())%len(fuzzVars)]
+}
+
+func (d *decoder) poly() Poly {
+	m := make(map[string]float64)
+	for i := int(d.byte())%4 + 1; i > 0; i-- {
+		c := d.num()
+		var monomials []string
+		var exponents []int
+		for j := int(d.byte()) % 6; j > 0; j-- {
+			monomials = append(monomials, polyName(d.variable()))
+			exponents = append(exponents, int(int8(d.byte())))
+		}
+		m[makePolyTerm(monomials, exponents)] += c
+	}
+	for key, c := range m {
+		if c == 0 {
+			delete(m, key)
+		}
+	}
+	return Poly{m}
+}
+
+func (d *decoder) expression(depth int) Expression {
+	tag := int(d.byte()) % tags
+	if depth >= maxFuzzDepth {
+		tag %= tagAdd
+	}
+	sub := func() Expression {
+		return d.expression(depth + 1)
+	}
+	switch tag {
+	case tagNum:
+		return Num{d.num()}
+	case tagVar:
+		return d.variable()
+	case tagPoly:
+		return d.poly()
+	case tagAdd:
+		return Add{sub(), sub()}
+	case tagMul:
+		return Mul{sub(), sub()}
+	case tagDiv:
+		return Div{sub(), sub()}
+	case tagPow:
+		n := float64(int8(d.byte())) / 4
+		power := d.power
+		if p := math.Max(1, math.Abs(n)); power*p > maxFuzzPower {
+			n = 1
+		} else {
+			d.power *= p
+		}
+		base := sub()
+		d.power = power
+		return Pow{base, n}
+	case tagSin:
+		return Sin{sub()}
+	case tagCos:
+		return Cos{sub()}
+	}
+	return con{sub()}
+}
+
+func decode(b []byte) Expression {
+	d := &decoder{b, 1}
+	return d.expression(0)
+}
+
+// encode is the inverse of decode, for seeding the
+// corpora. It fails on trees decode can't produce.
+func encode(e Expression) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			b, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	num := func(f float64) {
+		q := f * 4
+		if q != math.Trunc(q) || q < math.MinInt16 || q > math.MaxInt16 {
+			panic(fmt.Sprintf("can't encode number %v", f))
+		}
+		n := uint16(int16(q))
+		b = append(b, byte(n), byte(n>>8))
+	}
+	variable := func(v Var) {
+		for i, w := range fuzzVars {
+			if v == w {
+				b = append(b, byte(i))
+				return
+			}
+		}
+		panic("can't encode variable " + v.Name)
+	}
+	var rec func(Expression)
+	rec = func(e Expression) {
+		switch v := e.(type) {
+		case Num:
+			b = append(b, tagNum)
+			num(v.Val)
+		case Var:
+			b = append(b, tagVar)
+			variable(v)
+		case Poly:
+			if len(v.terms) < 1 || len(v.terms) > 4 {
+				panic(fmt.Sprintf("can't encode %v terms", len(v.terms)))
+			}
+			b = append(b, tagPoly, byte(len(v.terms)-1))
+			keys := sortedKeys(v.terms)
+			for _, key := range keys {
+				num(v.terms[key])
+				monomials, exponents := decomposePoly(key)
+				if len(monomials) > 5 {
+					panic("can't encode monomial " + key)
+				}
+				b = append(b, byte(len(monomials)))
+				for i, m := range monomials {
+					variable(indeterminate(m).(Var))
+					b = append(b, byte(int8(exponents[i])))
+				}
+			}
+		case Add:
+			b = append(b, tagAdd)
+			rec(v.E1)
+			rec(v.E2)
+		case Mul:
+			b = append(b, tagMul)
+			rec(v.E1)
+			rec(v.E2)
+		case Div:
+			b = append(b, tagDiv)
+			rec(v.E1)
+			rec(v.E2)
+		case Pow:
+			b = append(b, tagPow, byte(int8(v.Exponent*4)))
+			rec(v.Base)
+		case Sin:
+			b = append(b, tagSin)
+			rec(v.E1)
+		case Cos:
+			b = append(b, tagCos)
+			rec(v.E1)
+		case con:
+			b = append(b, tagCon)
+			rec(v.E1)
+		default:
+			panic(fmt.Sprintf("can't encode %T", e))
+		}
+	}
+	rec(e)
+	return b, nil
+}
+
+// tableExpressions gathers the expressions of the
+// existing test tables, at least those decode can
+// produce
+func tableExpressions() []Expression {
+	var es []Expression
+	for _, tt := range deriveTable() {
+		es = append(es, tt.function, tt.derivative)
+	}
+	for _, tt := range partialDeriveTable() {
+		es = append(es, tt.function, tt.derivative)
+	}
+	for _, tt := range simplifyTable() {
+		es = append(es, tt.f, tt.simplified)
+	}
+	for _, tt := range polyAddTable() {
+		es = append(es, newPoly(tt.p1), newPoly(tt.p2), newPoly(tt.sum))
+	}
+	for _, tt := range polyMulTable() {
+		es = append(es, newPoly(tt.p1), newPoly(tt.p2), newPoly(tt.product))
+	}
+	var r []Expression
+	for _, e := range es {
+		if _, err := encode(e); err == nil {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+// consistent compares values to a relative tolerance
+// of the magnitude, skipping non-finite ones
+func consistent(got, want, mag float64) bool {
+	if isNaNOrInf(got) || isNaNOrInf(want) || isNaNOrInf(mag) {
+		return true
+	}
+	return math.Abs(got-want) <= 1e-8*math.Max(1, mag)
+}
+
+// within runs f, failing t on a panic or when f
+// doesn't return in time, like on runaway recursion.
+// f reports through errorf, never t, since it may
+// still be running after the test has given up.
+func within(t *testing.T, f func(errorf func(string, ...interface{}))) {
+	t.Helper()
+	var errs []string
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		f(func(format string, a ...interface{}) {
+			errs = append(errs, fmt.Sprintf(format, a...))
+		})
+	}()
+	select {
+	case r := <-done:
+		for _, err := range errs {
+			t.Error(err)
+		}
+		if r != nil {
+			t.Fatalf("panic: %v", r)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no result after 10s")
+	}
+}
+
+func TestFuzzEncoding(t *testing.T) {
+	for _, e := range tableExpressions() {
+		b, _ := encode(e)
+		if got := decode(b); !reflect.DeepEqual(got, e) {
+			t.Errorf("decode(encode(%v)) got %v", Read(e), Read(got))
+		}
+	}
+}
+
+// FuzzExpression checks that Simplify, makePoly, Derive
+// and Read terminate without panicking, and that the
+// rewrites keep their value.
+func FuzzExpression(f *testing.F) {
+	for _, e := range tableExpressions() {
+		b, _ := encode(e)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		e := decode(b)
+		within(t, func(errorf func(string, ...interface{})) {
+			s := Simplify(e)
+			p := makePoly(s)
+			if Read(e) != Read(s) {
+				errorf("Read changes under Simplify: %v vs %v", Read(e), Read(s))
+			}
+			v := Eval(e, fuzzEnv)
+			for _, r := range []Expression{s, p} {
+				mag := math.Max(magnitude(e, fuzzEnv), magnitude(r, fuzzEnv))
+				if w := Eval(r, fuzzEnv); !consistent(w, v, mag) {
+					errorf("%v evaluates to %v, rewritten %v to %v", Read(e), v, Read(r), w)
+				}
+			}
+
+			// every variable moves at unit speed under
+			// Derive, so it sums the partials, holding
+			// subtrees marked constant fixed
+			d := Derive(e)
+			fixed := GenericParse(func(e Expression) (Expression, bool) {
+				if c, ok := e.(con); ok {
+					return Num{Eval(c, fuzzEnv)}, false
+				}
+				return e, true
+			}, func(e Expression) Expression {
+				return e
+			}, e)
+			want := 0.
+			for _, x := range Variables(fixed) {
+				want += EvalJet(fixed, x, fuzzEnv, 1).Derivative(1)
+			}
+			if got := Eval(d, fuzzEnv); !consistent(got, want, magnitude(d, fuzzEnv)) {
+				errorf("Derive %v evaluates to %v, want %v", Read(e), got, want)
+			}
+		})
+	})
+}
+
+// FuzzForwardSub substitutes a second decoded
+// tree for y in the first.
+func FuzzForwardSub(f *testing.F) {
+	es := tableExpressions()
+	for i := range es {
+		b, _ := encode(es[i])
+		c, _ := encode(es[(i+1)%len(es)])
+		f.Add(append(b, c...))
+	}
+	y := Var{"y"}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d := &decoder{b, 1}
+		e, s := d.expression(0), d.expression(0)
+		within(t, func(errorf func(string, ...interface{})) {
+			r := ForwardSub(e, s, y)
+			got := Eval(r, fuzzEnv)
+			env := bind(fuzzEnv, y.Name, Eval(s, fuzzEnv))
+			want := Eval(e, env)
+			mag := math.Max(magnitude(r, fuzzEnv), magnitude(e, env))
+			if !consistent(got, want, mag) {
+				errorf("substituting %v into %v: %v, want %v", Read(s), Read(e), got, want)
+			}
+		})
+	})
+}
+
+// FuzzPolyTerms exercises the monomial keys: reducing
+// is idempotent, and adding and multiplying term maps
+// agrees with adding and multiplying their values.
+func FuzzPolyTerms(f *testing.F) {
+	var ps []Poly
+	for _, tt := range polyAddTable() {
+		ps = append(ps, newPoly(tt.p1), newPoly(tt.p2))
+	}
+	for _, tt := range polyMulTable() {
+		ps = append(ps, newPoly(tt.p1), newPoly(tt.p2))
+	}
+	for i := 0; i+1 < len(ps); i += 2 {
+		b, err := encode(ps[i])
+		c, err1 := encode(ps[i+1])
+		if err != nil || err1 != nil {
+			continue
+		}
+		// encode adds the Poly tag, poly() doesn't read it
+		f.Add(append(b[1:], c[1:]...))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d := &decoder{b, 1}
+		p, q := d.poly(), d.poly()
+		within(t, func(errorf func(string, ...interface{})) {
+			for _, key := range append(sortedKeys(p.terms), sortedKeys(q.terms)...) {
+				if r := reduce(key); r != key {
+					errorf("reduce(%q) = %q", key, r)
+				}
+			}
+			if !reflect.DeepEqual(newPoly(p.terms), p) {
+				errorf("newPoly changes %v", p.terms)
+			}
+			a, b := Eval(p, fuzzEnv), Eval(q, fuzzEnv)
+			ma, mb := magnitude(p, fuzzEnv), magnitude(q, fuzzEnv)
+			if got := Eval(add(p, q), fuzzEnv); !consistent(got, a+b, ma+mb) {
+				errorf("%v + %v evaluates to %v, want %v", p.terms, q.terms, got, a+b)
+			}
+			if got := Eval(mul(p, q), fuzzEnv); !consistent(got, a*b, ma*mb) {
+				errorf("%v * %v evaluates to %v, want %v", p.terms, q.terms, got, a*b)
+			}
+		})
+	})
+}
@@ -0,0 +1,327 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// generator builds random well-formed expressions over
+// vars. Denominators and negative powers are kept away
+// from zero and fractional powers get positive bases,
+// so trees evaluate to finite values everywhere.
+type generator struct {
+	r    *rand.Rand
+	vars []Var
+}
+
+func newGenerator(seed int64, vars ...Var) *generator {
+	return &generator{rand.New(rand.NewSource(seed)), vars}
+}
+
+// positive wraps e so it lies in [1.5, 3.5]
+func positive(e Expression) Expression {
+	return Add{Num{2.5}, Cos{e}}
+}
+
+func (g *generator) leaf() Expression {
+	if g.r.Intn(3) == 0 {
+		return Num{float64(g.r.Intn(7) - 3)}
+	}
+	return g.vars[g.r.Intn(len(g.vars))]
+}
+
+func (g *generator) poly() Poly {
+	m := make(map[string]float64)
+	for i := g.r.Intn(3) + 1; i > 0; i-- {
+		var monomials []string
+		var exponents []int
+		for _, v := range g.vars {
+			if n := g.r.Intn(3); n > 0 {
+				monomials = append(monomials, polyName(v))
+				exponents = append(exponents, n)
+			}
+		}
+		m[makePolyTerm(monomials, exponents)] += float64(g.r.Intn(7) - 3)
+	}
+	for key, c := range m {
+		if c == 0 {
+			delete(m, key)
+		}
+	}
+	return Poly{m}
+}
+
+// expression returns a tree at most depth levels deep.
+func (g *generator) expression(depth int) Expression {
+	if depth == 0 || g.r.Intn(4) == 0 {
+		if g.r.Intn(5) == 0 {
+			return g.poly()
+		}
+		return g.leaf()
+	}
+	sub := func() Expression {
+		return g.expression(depth - 1)
+	}
+	switch g.r.Intn(8) {
+	case 0:
+		return Add{sub(), sub()}
+	case 1:
+		return Mul{sub(), sub()}
+	case 2:
+		return Div{sub(), positive(sub())}
+	case 3:
+		return Pow{sub(), float64(g.r.Intn(4))}
+	case 4:
+		return Pow{positive(sub()), float64(-g.r.Intn(3) - 1)}
+	case 5:
+		return Pow{positive(sub()), .5}
+	case 6:
+		return Sin{sub()}
+	}
+	return Cos{sub()}
+}
+
+// point binds every variable in [-1, 1]
+func (g *generator) point() map[string]float64 {
+	p := make(map[string]float64)
+	for _, v := range g.vars {
+		p[v.Name] = 2*g.r.Float64() - 1
+	}
+	return p
+}
+
+// points binds every variable of g at n points.
+// Properties draw their points up front so
+// that shrinking replays them exactly.
+func (g *generator) points(n int) []map[string]float64 {
+	var ps []map[string]float64
+	for i := 0; i < n; i++ {
+		ps = append(ps, g.point())
+	}
+	return ps
+}
+
+// candidates lists expressions smaller than e: its
+// children, simpler leaves, and e with one child
+// replaced by one of that child's candidates.
+func candidates(e Expression) []Expression {
+	var cs []Expression
+	// numbers rank 0, 1, then the rest, below
+	// anything else, so shrinking terminates
+	leaves := func(e Expression) {
+		if n, ok := e.(Num); ok {
+			switch {
+			case n.Val == 0:
+			case n.Val == 1:
+				cs = append(cs, Num{0.})
+			default:
+				cs = append(cs, Num{0.}, Num{1.})
+			}
+			return
+		}
+		cs = append(cs, Num{0.}, Num{1.})
+	}
+	switch v := e.(type) {
+	case Num:
+		leaves(v)
+	case Var:
+		leaves(v)
+	case Poly:
+		leaves(v)
+		if len(v.terms) < 2 {
+			break
+		}
+		for key := range v.terms {
+			m := make(map[string]float64)
+			for k, c := range v.terms {
+				if k != key {
+					m[k] = c
+				}
+			}
+			cs = append(cs, Poly{m}, Poly{map[string]float64{key: v.terms[key]}})
+		}
+	case Add:
+		cs = append(cs, v.E1, v.E2)
+		for _, c := range candidates(v.E1) {
+			cs = append(cs, Add{c, v.E2})
+		}
+		for _, c := range candidates(v.E2) {
+			cs = append(cs, Add{v.E1, c})
+		}
+	case Mul:
+		cs = append(cs, v.E1, v.E2)
+		for _, c := range candidates(v.E1) {
+			cs = append(cs, Mul{c, v.E2})
+		}
+		for _, c := range candidates(v.E2) {
+			cs = append(cs, Mul{v.E1, c})
+		}
+	case Div:
+		cs = append(cs, v.E1, v.E2)
+		for _, c := range candidates(v.E1) {
+			cs = append(cs, Div{c, v.E2})
+		}
+		for _, c := range candidates(v.E2) {
+			cs = append(cs, Div{v.E1, c})
+		}
+	case Pow:
+		cs = append(cs, v.Base)
+		if v.Exponent != 1 {
+			cs = append(cs, Pow{v.Base, 1.})
+		}
+		for _, c := range candidates(v.Base) {
+			cs = append(cs, Pow{c, v.Exponent})
+		}
+	case Sin:
+		cs = append(cs, v.E1)
+		for _, c := range candidates(v.E1) {
+			cs = append(cs, Sin{c})
+		}
+	case Cos:
+		cs = append(cs, v.E1)
+		for _, c := range candidates(v.E1) {
+			cs = append(cs, Cos{c})
+		}
+	}
+	return cs
+}
+
+// shrink greedily replaces e by smaller candidates
+// that still fail, until none does.
+func shrink(e Expression, fails func(Expression) bool) Expression {
+	for {
+		smaller := false
+		for _, c := range candidates(e) {
+			if fails(c) {
+				e, smaller = c, true
+				break
+			}
+		}
+		if !smaller {
+			return e
+		}
+	}
+}
+
+// holds runs prop, counting a panic as a failure
+func holds(prop func(Expression) error, e Expression) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return prop(e)
+}
+
+// checkProperty runs prop over n random expressions,
+// reporting each failure shrunk to a minimal one.
+func checkProperty(t *testing.T, name string, g *generator, n int, prop func(Expression) error) {
+	t.Helper()
+	fails := func(e Expression) bool {
+		return holds(prop, e) != nil
+	}
+	for i := 0; i < n; i++ {
+		e := g.expression(4)
+		if !fails(e) {
+			continue
+		}
+		min := shrink(e, fails)
+		t.Errorf("%v fails for %v: %v\n(shrunk from %v)", name, Read(min), holds(prop, min), Read(e))
+	}
+}
+
+// sameValue compares a and b at points, to a relative
+// tolerance floored at 1, skipping non-finite values
+func sameValue(a, b Expression, points []map[string]float64, tol float64) error {
+	for _, p := range points {
+		x, y := Eval(a, p), Eval(b, p)
+		if isNaNOrInf(x) || isNaNOrInf(y) {
+			continue
+		}
+		if math.Abs(x-y) > tol*math.Max(1, math.Abs(x)) {
+			return fmt.Errorf("%v vs %v at %v", x, y, p)
+		}
+	}
+	return nil
+}
+
+func TestShrink(t *testing.T) {
+	x := Var{"x"}
+	e := Add{Mul{x, Sin{Add{x, Num{2.}}}}, Cos{x}}
+	hasSin := func(e Expression) bool {
+		found := false
+		before := func(e Expression) (Expression, bool) {
+			if _, ok := e.(Sin); ok {
+				found = true
+			}
+			return e, true
+		}
+		after := func(e Expression) Expression {
+			return e
+		}
+		GenericParse(before, after, e)
+		return found
+	}
+	if got, want := shrink(e, hasSin), (Sin{Num{0.}}); got != want {
+		t.Errorf("shrink got %v, want %v", Read(got), Read(want))
+	}
+}
+
+func TestSimplifyProperty(t *testing.T) {
+	g := newGenerator(48, Var{"x"}, Var{"y"})
+	points := g.points(3)
+	checkProperty(t, "Simplify preserves value", g, 500, func(e Expression) error {
+		return sameValue(e, Simplify(e), points, 1e-9)
+	})
+}
+
+func TestMakePolyProperty(t *testing.T) {
+	g := newGenerator(49, Var{"x"}, Var{"y"})
+	points := g.points(3)
+	checkProperty(t, "makePoly preserves value", g, 500, func(e Expression) error {
+		return sameValue(e, makePoly(Simplify(e)), points, 1e-9)
+	})
+}
+
+func TestDeriveFiniteDifferenceProperty(t *testing.T) {
+	g := newGenerator(50, Var{"x"}, Var{"y"})
+	points := g.points(3)
+	checkProperty(t, "Derive agrees with finite differences", g, 500, func(e Expression) error {
+		// every variable moves at
+		// unit rate under Derive
+		d := Derive(e)
+		for _, p := range points {
+			n := 0.
+			for _, v := range Variables(e) {
+				n += richardson(e, v, p)
+			}
+			if s := Eval(d, p); math.Abs(s-n) > 1e-6*math.Max(1, math.Abs(n)) {
+				return fmt.Errorf("%v vs %v at %v", s, n, p)
+			}
+		}
+		return nil
+	})
+}
+
+func TestForwardSubProperty(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	g := newGenerator(51, x, y)
+	points := g.points(3)
+	var subs []Expression
+	for i := 0; i < 3; i++ {
+		subs = append(subs, newGenerator(int64(52+i), x).expression(2))
+	}
+	checkProperty(t, "ForwardSub then Eval matches binding", g, 500, func(e Expression) error {
+		for i, s := range subs {
+			p := points[i]
+			got := Eval(ForwardSub(e, s, y), p)
+			want := Eval(e, bind(p, "y", Eval(s, p)))
+			if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+				return fmt.Errorf("substituting %v: %v vs %v at %v", Read(s), got, want, p)
+			}
+		}
+		return nil
+	})
+}
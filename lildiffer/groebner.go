@@ -0,0 +1,377 @@
+package lildiffer
+
+import (
+	"math/big"
+	"sort"
+)
+
+// A MonomialOrder ranks monomials for Groebner
+// basis computations. Vars fixes the variable
+// precedence; variables found in the polynomials
+// but missing from Vars rank after them, sorted
+// by name.
+type MonomialOrder struct {
+	Vars []Var
+	// cmp returns >0 when exponent vector a
+	// ranks above b
+	cmp func(a, b []int) int
+}
+
+// Lex is the lexicographic order, the one
+// to use for elimination.
+func Lex(vars ...Var) MonomialOrder {
+	return MonomialOrder{vars, lexCmp}
+}
+
+// GrLex orders by total degree, ties broken
+// lexicographically.
+func GrLex(vars ...Var) MonomialOrder {
+	return MonomialOrder{vars, func(a, b []int) int {
+		if d := degree(a) - degree(b); d != 0 {
+			return d
+		}
+		return lexCmp(a, b)
+	}}
+}
+
+// GrevLex orders by total degree, ties broken
+// by the reverse lexicographic rule. Usually the
+// cheapest order to compute a basis in.
+func GrevLex(vars ...Var) MonomialOrder {
+	return MonomialOrder{vars, func(a, b []int) int {
+		if d := degree(a) - degree(b); d != 0 {
+			return d
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			if a[i] != b[i] {
+				return b[i] - a[i]
+			}
+		}
+		return 0
+	}}
+}
+
+func lexCmp(a, b []int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+func degree(a []int) int {
+	d := 0
+	for _, e := range a {
+		d += e
+	}
+	return d
+}
+
+// a term over a fixed list of variables
+type rterm struct {
+	exp  []int
+	coef *big.Rat
+}
+
+// a polynomial as terms sorted by
+// decreasing monomial order
+type rpoly []rterm
+
+// variables returns the order's variable list
+// extended by every variable occurring in ps.
+func (o MonomialOrder) variables(ps []RatPoly) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, v := range o.Vars {
+		if n := polyName(v); !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	var rest []string
+	for _, p := range ps {
+		for key := range p.terms {
+			monomials, _ := decomposePoly(key)
+			for _, m := range monomials {
+				if !seen[m] {
+					seen[m] = true
+					rest = append(rest, m)
+				}
+			}
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+func (o MonomialOrder) toR(p RatPoly, names []string) rpoly {
+	index := make(map[string]int)
+	for i, n := range names {
+		index[n] = i
+	}
+	var r rpoly
+	for key, value := range p.terms {
+		exp := make([]int, len(names))
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			exp[index[m]] += exponents[i]
+		}
+		r = append(r, rterm{exp, new(big.Rat).Set(value)})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return o.cmp(r[i].exp, r[j].exp) > 0
+	})
+	return r
+}
+
+func fromR(r rpoly, names []string) RatPoly {
+	m := make(map[string]*big.Rat)
+	for _, t := range r {
+		var monomials []string
+		var exponents []int
+		for i, e := range t.exp {
+			if e != 0 {
+				monomials = append(monomials, names[i])
+				exponents = append(exponents, e)
+			}
+		}
+		m[makePolyTerm(monomials, exponents)] = new(big.Rat).Set(t.coef)
+	}
+	return RatPoly{m}
+}
+
+// addScaled returns p + c*x^m*q
+func (o MonomialOrder) addScaled(p, q rpoly, c *big.Rat, m []int) rpoly {
+	var r rpoly
+	i, j := 0, 0
+	for i < len(p) || j < len(q) {
+		if j == len(q) {
+			r = append(r, p[i])
+			i++
+			continue
+		}
+		exp := make([]int, len(m))
+		for k := range m {
+			exp[k] = q[j].exp[k] + m[k]
+		}
+		d := -1
+		if i < len(p) {
+			d = o.cmp(p[i].exp, exp)
+		}
+		switch {
+		case d > 0:
+			r = append(r, p[i])
+			i++
+		case d < 0:
+			r = append(r, rterm{exp, new(big.Rat).Mul(c, q[j].coef)})
+			j++
+		default:
+			s := new(big.Rat).Mul(c, q[j].coef)
+			s.Add(s, p[i].coef)
+			if s.Sign() != 0 {
+				r = append(r, rterm{exp, s})
+			}
+			i++
+			j++
+		}
+	}
+	return r
+}
+
+func divides(a, b []int) bool {
+	for i := range a {
+		if a[i] > b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func monic(p rpoly) rpoly {
+	if len(p) == 0 {
+		return p
+	}
+	inv := new(big.Rat).Inv(p[0].coef)
+	r := make(rpoly, len(p))
+	for i, t := range p {
+		r[i] = rterm{t.exp, new(big.Rat).Mul(t.coef, inv)}
+	}
+	return r
+}
+
+// reduceR returns the normal form of f
+// with respect to gs.
+func (o MonomialOrder) reduceR(f rpoly, gs []rpoly) rpoly {
+	var rem rpoly
+	for len(f) > 0 {
+		lt := f[0]
+		reduced := false
+		for _, g := range gs {
+			if len(g) == 0 || !divides(g[0].exp, lt.exp) {
+				continue
+			}
+			m := make([]int, len(lt.exp))
+			for k := range m {
+				m[k] = lt.exp[k] - g[0].exp[k]
+			}
+			c := new(big.Rat).Quo(lt.coef, g[0].coef)
+			f = o.addScaled(f, g, c.Neg(c), m)
+			reduced = true
+			break
+		}
+		if !reduced {
+			rem = append(rem, lt)
+			f = f[1:]
+		}
+	}
+	return rem
+}
+
+// sPoly is the S-polynomial of monic f and g.
+func (o MonomialOrder) sPoly(f, g rpoly) rpoly {
+	n := len(f[0].exp)
+	mf := make([]int, n)
+	mg := make([]int, n)
+	for k := 0; k < n; k++ {
+		l := f[0].exp[k]
+		if g[0].exp[k] > l {
+			l = g[0].exp[k]
+		}
+		mf[k] = l - f[0].exp[k]
+		mg[k] = l - g[0].exp[k]
+	}
+	s := o.addScaled(nil, f, big.NewRat(1, 1), mf)
+	return o.addScaled(s, g, big.NewRat(-1, 1), mg)
+}
+
+// coprime leading monomials never yield
+// new basis elements (Buchberger's criterion)
+func coprime(a, b []int) bool {
+	for i := range a {
+		if a[i] != 0 && b[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// GroebnerBasis runs Buchberger's algorithm and
+// returns the reduced Groebner basis of the ideal
+// generated by ps, monic and sorted by decreasing
+// leading monomial.
+func GroebnerBasis(ps []RatPoly, order MonomialOrder) []RatPoly {
+	names := order.variables(ps)
+	var gs []rpoly
+	for _, p := range ps {
+		if r := order.toR(p, names); len(r) > 0 {
+			gs = append(gs, monic(r))
+		}
+	}
+
+	type pair struct{ i, j int }
+	var pairs []pair
+	for j := range gs {
+		for i := 0; i < j; i++ {
+			pairs = append(pairs, pair{i, j})
+		}
+	}
+	for len(pairs) > 0 {
+		pr := pairs[0]
+		pairs = pairs[1:]
+		if coprime(gs[pr.i][0].exp, gs[pr.j][0].exp) {
+			continue
+		}
+		h := order.reduceR(order.sPoly(gs[pr.i], gs[pr.j]), gs)
+		if len(h) == 0 {
+			continue
+		}
+		gs = append(gs, monic(h))
+		for i := 0; i < len(gs)-1; i++ {
+			pairs = append(pairs, pair{i, len(gs) - 1})
+		}
+	}
+
+	// Minimize: drop elements whose leading monomial
+	// is divisible by another's
+	var minimal []rpoly
+	for i, g := range gs {
+		redundant := false
+		for j, h := range gs {
+			if i == j || !divides(h[0].exp, g[0].exp) {
+				continue
+			}
+			// of two equal leading monomials keep the first
+			if lexCmp(h[0].exp, g[0].exp) != 0 || j < i {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			minimal = append(minimal, g)
+		}
+	}
+
+	// Reduce every element by the others
+	reduced := make([]rpoly, len(minimal))
+	for i, g := range minimal {
+		others := make([]rpoly, 0, len(minimal)-1)
+		others = append(others, minimal[:i]...)
+		others = append(others, minimal[i+1:]...)
+		reduced[i] = monic(order.reduceR(g, others))
+	}
+	sort.Slice(reduced, func(i, j int) bool {
+		return order.cmp(reduced[i][0].exp, reduced[j][0].exp) > 0
+	})
+
+	var ret []RatPoly
+	for _, r := range reduced {
+		ret = append(ret, fromR(r, names))
+	}
+	return ret
+}
+
+// Reduce returns the remainder of f on division
+// by gs. When gs is a Groebner basis under order the
+// remainder is the unique normal form of f.
+func Reduce(f RatPoly, gs []RatPoly, order MonomialOrder) RatPoly {
+	names := order.variables(append([]RatPoly{f}, gs...))
+	var rs []rpoly
+	for _, g := range gs {
+		rs = append(rs, order.toR(g, names))
+	}
+	return fromR(order.reduceR(order.toR(f, names), rs), names)
+}
+
+// IdealMember reports whether f lies in the
+// ideal generated by ps.
+func IdealMember(f RatPoly, ps []RatPoly) bool {
+	order := GrevLex()
+	return Reduce(f, GroebnerBasis(ps, order), order).IsZero()
+}
+
+// Eliminate returns generators of the elimination
+// ideal: the polynomials of the ideal generated by ps
+// that don't involve any of vars.
+func Eliminate(ps []RatPoly, vars ...Var) []RatPoly {
+	drop := make(map[string]bool)
+	for _, v := range vars {
+		drop[polyName(v)] = true
+	}
+	var ret []RatPoly
+	for _, g := range GroebnerBasis(ps, Lex(vars...)) {
+		keep := true
+		for key := range g.terms {
+			monomials, _ := decomposePoly(key)
+			for _, m := range monomials {
+				if drop[m] {
+					keep = false
+				}
+			}
+		}
+		if keep {
+			ret = append(ret, g)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,124 @@
+package lildiffer
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestRatFromFloat(t *testing.T) {
+	table := []struct {
+		f    float64
+		want *big.Rat
+	}{
+		{0.5, big.NewRat(1, 2)},
+		{-3, big.NewRat(-3, 1)},
+		{1. / 3., big.NewRat(1, 3)},
+		{-2.75, big.NewRat(-11, 4)},
+		{0, big.NewRat(0, 1)},
+	}
+	for _, tt := range table {
+		if got := ratFromFloat(tt.f); got.Cmp(tt.want) != 0 {
+			t.Errorf("ratFromFloat(%v) = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestGroebnerBasis(t *testing.T) {
+	type ptype map[string]float64
+	x, y := Var{"x"}, Var{"y"}
+	table := []struct {
+		description string
+		ideal       []ptype
+		order       MonomialOrder
+		basis       []ptype
+	}{
+		// Cox, Little, O'Shea, Ideals, Varieties and Algorithms 2.7
+		{"x^3-2xy, x^2y-2y^2+x",
+			[]ptype{
+				{"x^3": 1, "xy": -2},
+				{"x^2y": 1, "y^2": -2, "x": 1},
+			},
+			GrLex(x, y),
+			[]ptype{
+				{"x^2": 1},
+				{"xy": 1},
+				{"y^2": 1, "x": -.5},
+			},
+		},
+		{"x^2+y, xy-1",
+			[]ptype{
+				{"x^2": 1, "y": 1},
+				{"xy": 1, "": -1},
+			},
+			Lex(x, y),
+			[]ptype{
+				{"x": 1, "y^2": 1},
+				{"y^3": 1, "": 1},
+			},
+		},
+		{"inconsistent x-1, x-2",
+			[]ptype{{"x": 1, "": -1}, {"x": 1, "": -2}},
+			Lex(x),
+			[]ptype{{"": 1}},
+		},
+	}
+	for _, tt := range table {
+		var ideal []RatPoly
+		for _, p := range tt.ideal {
+			ideal = append(ideal, ToRatPoly(newPoly(p)))
+		}
+		var got, want []Poly
+		for _, g := range GroebnerBasis(ideal, tt.order) {
+			got = append(got, g.Poly())
+		}
+		for _, p := range tt.basis {
+			want = append(want, newPoly(p))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GroebnerBasis %v\ngot  %v\nwant %v", tt.description, got, want)
+		}
+	}
+}
+
+func TestIdealMember(t *testing.T) {
+	type ptype map[string]float64
+	ideal := []RatPoly{
+		ToRatPoly(newPoly(ptype{"x^3": 1, "xy": -2})),
+		ToRatPoly(newPoly(ptype{"x^2y": 1, "y^2": -2, "x": 1})),
+	}
+	table := []struct {
+		p    ptype
+		want bool
+	}{
+		{ptype{"x^2": 1}, true},
+		{ptype{"y^2": 2, "x": -1, "xy": 7}, true},
+		{ptype{"x": 1}, false},
+		{ptype{"": 1}, false},
+	}
+	for _, tt := range table {
+		if got := IdealMember(ToRatPoly(newPoly(tt.p)), ideal); got != tt.want {
+			t.Errorf("IdealMember(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+// Implicitize the twisted cubic x = t^2, y = t^3
+func TestEliminate(t *testing.T) {
+	type ptype map[string]float64
+	ideal := []RatPoly{
+		ToRatPoly(newPoly(ptype{"x": 1, "t^2": -1})),
+		ToRatPoly(newPoly(ptype{"y": 1, "t^3": -1})),
+	}
+	got := Eliminate(ideal, Var{"t"})
+	want, err := NewRatPoly(map[string]*big.Rat{
+		"x^3": big.NewRat(1, 1),
+		"y^2": big.NewRat(-1, 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Equal(want) {
+		t.Errorf("Eliminate got %v, want [%v]", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package lildiffer
+
+import (
+	"sort"
+)
+
+// A CompiledPoly evaluates a Poly in nested
+// multivariate Horner form, with the monomial
+// keys parsed once up front. It reuses scratch
+// space, so isn't safe for concurrent use.
+type CompiledPoly struct {
+	// indeterminates, in nesting order
+	atoms []Expression
+	root  *horner
+	// scratch space for indeterminate values
+	x []float64
+}
+
+// horner is c when v < 0, otherwise
+// sum over i of coefs[i] * x[v]^exps[i]
+// with exps descending
+type horner struct {
+	v     int
+	c     float64
+	exps  []int
+	coefs []*horner
+}
+
+type hterm struct {
+	exp  []int
+	coef float64
+}
+
+// CompilePoly prepares p for repeated evaluation.
+func CompilePoly(p Poly) *CompiledPoly {
+	index := make(map[string]int)
+	var names []string
+	for key := range p.terms {
+		monomials, _ := decomposePoly(key)
+		for _, m := range monomials {
+			if _, ok := index[m]; !ok {
+				index[m] = 0
+				names = append(names, m)
+			}
+		}
+	}
+	sort.Strings(names)
+	c := &CompiledPoly{x: make([]float64, len(names))}
+	for i, m := range names {
+		index[m] = i
+		c.atoms = append(c.atoms, indeterminate(m))
+	}
+
+	var terms []hterm
+	for key, coef := range p.terms {
+		exp := make([]int, len(names))
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			exp[index[m]] += exponents[i]
+		}
+		terms = append(terms, hterm{exp, coef})
+	}
+	c.root = buildHorner(terms, 0)
+	return c
+}
+
+// buildHorner nests terms on variable v and up
+func buildHorner(terms []hterm, v int) *horner {
+	if len(terms) == 0 {
+		return &horner{v: -1}
+	}
+	if v == len(terms[0].exp) {
+		h := &horner{v: -1}
+		for _, t := range terms {
+			h.c += t.coef
+		}
+		return h
+	}
+	groups := make(map[int][]hterm)
+	for _, t := range terms {
+		groups[t.exp[v]] = append(groups[t.exp[v]], t)
+	}
+	if _, ok := groups[0]; ok && len(groups) == 1 {
+		// v doesn't occur here
+		return buildHorner(terms, v+1)
+	}
+	h := &horner{v: v}
+	for e := range groups {
+		h.exps = append(h.exps, e)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(h.exps)))
+	for _, e := range h.exps {
+		h.coefs = append(h.coefs, buildHorner(groups[e], v+1))
+	}
+	return h
+}
+
+// integer powers by repeated squaring
+func ipow(x float64, n int) float64 {
+	if n < 0 {
+		return 1 / ipow(x, -n)
+	}
+	r := 1.
+	for n > 0 {
+		if n&1 == 1 {
+			r *= x
+		}
+		x *= x
+		n >>= 1
+	}
+	return r
+}
+
+func (h *horner) eval(x []float64) float64 {
+	if h.v < 0 {
+		return h.c
+	}
+	xv := x[h.v]
+	r := h.coefs[0].eval(x)
+	for i := 1; i < len(h.exps); i++ {
+		r = r*ipow(xv, h.exps[i-1]-h.exps[i]) + h.coefs[i].eval(x)
+	}
+	return r * ipow(xv, h.exps[len(h.exps)-1])
+}
+
+// Eval computes the polynomial at env. Atoms
+// like Sin(x) are evaluated once per call.
+func (c *CompiledPoly) Eval(env map[string]float64) float64 {
+	for i, a := range c.atoms {
+		if v, ok := a.(Var); ok {
+			val, ok := env[v.Name]
+			if !ok {
+				panic("unbound variable " + v.Name)
+			}
+			c.x[i] = val
+			continue
+		}
+		c.x[i] = Eval(a, env)
+	}
+	return c.root.eval(c.x)
+}
+
+// EvalBatch evaluates the polynomial at every point.
+func (c *CompiledPoly) EvalBatch(points []map[string]float64) []float64 {
+	r := make([]float64, len(points))
+	for i, env := range points {
+		r[i] = c.Eval(env)
+	}
+	return r
+}
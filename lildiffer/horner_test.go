@@ -0,0 +1,82 @@
+package lildiffer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// (1+x+y+z)^n, 286 terms for n = 10
+func densePoly(n int) Poly {
+	type ptype map[string]float64
+	base := newPoly(ptype{"": 1, "x": 1, "y": -.5, "z": .25})
+	p := newPoly(ptype{"": 1})
+	for i := 0; i < n; i++ {
+		p = mul(p, base)
+	}
+	return p
+}
+
+func TestCompilePoly(t *testing.T) {
+	type ptype map[string]float64
+	x := Var{"x"}
+	table := []struct {
+		description string
+		p           Poly
+	}{
+		{"constant", newPoly(ptype{"": 3.5})},
+		{"zero", newPoly(ptype{})},
+		{"sparse", newPoly(ptype{"x^7y": 2, "x^2": -1, "z^3": 4, "": 1})},
+		{"negative exponents", newPoly(ptype{"x^-2y": 2, "x": -1, "y^-1": 3})},
+		{"atoms", makePoly(Add{Mul{Pow{Sin{x}, 2.}, x}, Mul{Var{"theta"}, Cos{x}}}).(Poly)},
+		{"(1+x+y+z)^6", densePoly(6)},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range table {
+		c := CompilePoly(tt.p)
+		for i := 0; i < 20; i++ {
+			env := map[string]float64{
+				"x":     rng.Float64()*2 + .5,
+				"y":     rng.Float64()*2 - 3,
+				"z":     rng.Float64(),
+				"theta": rng.Float64(),
+			}
+			want := Eval(tt.p, env)
+			got := c.Eval(env)
+			if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+				t.Errorf("CompilePoly %v at %v got %v, want %v", tt.description, env, got, want)
+			}
+		}
+	}
+}
+
+func benchPoints(n int) []map[string]float64 {
+	rng := rand.New(rand.NewSource(1))
+	points := make([]map[string]float64, n)
+	for i := range points {
+		points[i] = map[string]float64{
+			"x": rng.Float64(), "y": rng.Float64(), "z": rng.Float64(),
+		}
+	}
+	return points
+}
+
+func BenchmarkEvalPolyNaive(b *testing.B) {
+	p := densePoly(10)
+	points := benchPoints(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, env := range points {
+			Eval(p, env)
+		}
+	}
+}
+
+func BenchmarkEvalPolyHorner(b *testing.B) {
+	c := CompilePoly(densePoly(10))
+	points := benchPoints(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.EvalBatch(points)
+	}
+}
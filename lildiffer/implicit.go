@@ -0,0 +1,62 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// An Equation states that Left equals Right.
+type Equation struct {
+	Left, Right Expression
+}
+
+// ImplicitDerive returns the order-th derivative of dependent
+// with respect to independent along the curve eq, in terms of
+// both variables. With F = Left - Right the first derivative
+// is -F_x/F_y.
+//
+// Higher orders keep the form N/F_y^(2k-1) with N polynomial
+// in F's partials: differentiating totally along the curve,
+// d/dx = d/dx + y' d/dy, gives
+//
+//	N' = (N_x F_y - N_y F_x) F_y - m N (F_yx F_y - F_yy F_x)
+//
+// over F_y^(m+2), which avoids nesting quotients.
+func ImplicitDerive(eq Equation, dependent, independent Var, order int) Expression {
+	if order < 0 {
+		panic("negative derivative order")
+	}
+	if order == 0 {
+		return dependent
+	}
+	simp := func(e Expression) Expression {
+		return makePoly(Simplify(e))
+	}
+	f := Add{eq.Left, Mul{Num{-1.}, eq.Right}}
+	fx := simp(PartialDerive(independent, f))
+	fy := simp(PartialDerive(dependent, f))
+	// total derivative of F_y times F_y
+	dfy := simp(Add{
+		Mul{PartialDerive(independent, fy), fy},
+		Mul{Num{-1.}, Mul{PartialDerive(dependent, fy), fx}},
+	})
+
+	n := simp(Mul{Num{-1.}, fx})
+	m := 1
+	for i := 1; i < order; i++ {
+		nx := PartialDerive(independent, n)
+		ny := PartialDerive(dependent, n)
+		n = simp(Add{
+			Mul{Add{Mul{nx, fy}, Mul{Num{-1.}, Mul{ny, fx}}}, fy},
+			Mul{Num{-float64(m)}, Mul{n, dfy}},
+		})
+		m += 2
+	}
+
+	if c, ok := fy.(Num); ok {
+		return simp(Mul{Num{math.Pow(c.Val, -float64(m))}, n})
+	}
+	if m == 1 {
+		return Div{n, fy}
+	}
+	return Div{n, Pow{fy, float64(m)}}
+}
@@ -0,0 +1,47 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestImplicitDerive(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	table := []struct {
+		description string
+		eq          Equation
+		point       map[string]float64
+		want        []float64
+	}{
+		{"circle x^2 + y^2 = 1",
+			Equation{Add{Pow{x, 2.}, Pow{y, 2.}}, Num{1.}},
+			map[string]float64{"x": .6, "y": .8},
+			[]float64{.8, -.75, -1 / math.Pow(.8, 3)},
+		},
+		{"hyperbola xy = 1",
+			Equation{Mul{x, y}, Num{1.}},
+			map[string]float64{"x": 2., "y": .5},
+			[]float64{.5, -.25, .25, -.375},
+		},
+		{"y = sin(x)",
+			Equation{y, Sin{x}},
+			map[string]float64{"x": .4, "y": math.Sin(.4)},
+			[]float64{math.Sin(.4), math.Cos(.4), -math.Sin(.4), -math.Cos(.4)},
+		},
+		{"y^3 + y = x over Div and Pow",
+			Equation{Div{Add{Pow{y, 3.}, y}, x}, Num{1.}},
+			map[string]float64{"x": 2., "y": 1.},
+			// y' = 1/(3y^2+1), y'' = -6y y'^3
+			[]float64{1., .25, -6 * .25 * .25 * .25},
+		},
+	}
+	for _, tt := range table {
+		for order, want := range tt.want {
+			d := ImplicitDerive(tt.eq, y, x, order)
+			if got := Eval(d, tt.point); math.Abs(got-want) > 1e-9 {
+				t.Errorf("ImplicitDerive %v order %v got %v = %v, want %v",
+					tt.description, order, Read(d), got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package lildiffer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Integrate finds an antiderivative of e in v, without
+// the constant of integration. e is expanded into a
+// polynomial whose atoms are integrated termwise: factors
+// not involving v come out front, powers of v follow the
+// power rule, and a factor g(u) whose companion factors are
+// du/dv times something free of v integrates by substitution.
+// That covers Sin and Cos of linear arguments like Sin(ax),
+// x Cos(x^2), Sin(x)^3 Cos(x) and the like. Anything else, including
+// 1/v which would need Log, is an error.
+func Integrate(e Expression, v Var) (Expression, error) {
+	p := polyOf(e)
+
+	var summands []Expression
+	for _, key := range sortedKeys(p.terms) {
+		term, err := integrateTerm(p.terms[key], key, v)
+		if err != nil {
+			return nil, err
+		}
+		summands = append(summands, term)
+	}
+	if len(summands) == 0 {
+		return Num{0.}, nil
+	}
+	z := summands[len(summands)-1]
+	for i := len(summands) - 2; i >= 0; i-- {
+		z = Add{summands[i], z}
+	}
+	return makePoly(Simplify(z)), nil
+}
+
+// polyOf views e as one polynomial, its quotients
+// turned into negative powers so they land in the
+// polynomial too.
+func polyOf(e Expression) Poly {
+	before := func(ex Expression) (Expression, bool) {
+		return ex, true
+	}
+	after := func(e Expression) Expression {
+		if d, ok := e.(Div); ok {
+			return Mul{d.E1, Pow{d.E2, -1.}}
+		}
+		return e
+	}
+	return asPoly(makePoly(Simplify(GenericParse(before, after, e))))
+}
+
+// a factor base^exponent of a polynomial term
+type factor struct {
+	base     Expression
+	exponent float64
+}
+
+func (f factor) expression() Expression {
+	if f.exponent == 1. {
+		return f.base
+	}
+	return Pow{f.base, f.exponent}
+}
+
+func isConstant(v Var, e Expression) bool {
+	_, ok := markTreesConstant(v, e).(con)
+	return ok
+}
+
+// integrateTerm integrates the monomial coef*key in v.
+func integrateTerm(coef float64, key string, v Var) (Expression, error) {
+	var c Expression = Num{coef}
+	var fs []factor
+	monomials, exponents := decomposePoly(key)
+	for i, m := range monomials {
+		f := factor{indeterminate(m), float64(exponents[i])}
+		if isConstant(v, f.base) {
+			c = Mul{c, f.expression()}
+			continue
+		}
+		// fractional powers come in as atoms
+		if p, ok := f.base.(Pow); ok {
+			f = factor{p.Base, p.Exponent * f.exponent}
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 0 {
+		return Mul{c, v}, nil
+	}
+
+	// try each factor as the outer function g(u)
+	// of a substitution
+	for i, f := range fs {
+		var rest Expression = Num{1.}
+		for j, g := range fs {
+			if j != i {
+				rest = Mul{rest, g.expression()}
+			}
+		}
+		type candidate struct{ u, g Expression }
+		var candidates []candidate
+		if f.exponent != -1. {
+			candidates = append(candidates, candidate{f.base,
+				Mul{Num{1 / (f.exponent + 1)}, Pow{f.base, f.exponent + 1}}})
+		}
+		if f.exponent == 1. {
+			switch b := f.base.(type) {
+			case Sin:
+				candidates = append(candidates, candidate{b.E1, Mul{Num{-1.}, Cos{b.E1}}})
+			case Cos:
+				candidates = append(candidates, candidate{b.E1, Sin{b.E1}})
+			}
+		}
+		for _, cd := range candidates {
+			du := asPoly(makePoly(Simplify(PartialDerive(v, cd.u))))
+			if k, ok := proportional(asPoly(makePoly(Simplify(rest))), du, v); ok {
+				return Mul{k, Mul{c, cd.g}}, nil
+			}
+		}
+	}
+	if len(fs) == 1 && fs[0].exponent == -1. {
+		return nil, fmt.Errorf("integrating %v in %v needs Log", key, v.Name)
+	}
+	return nil, fmt.Errorf("no antiderivative found for %v in %v", key, v.Name)
+}
+
+// proportional reports whether a = k*b for some k free
+// of v, like the a in d(ax)/dx, and returns k.
+func proportional(a, b Poly, v Var) (Expression, bool) {
+	as, bs := splitFree(a, v), splitFree(b, v)
+	if len(as) == 0 || len(as) != len(bs) {
+		return nil, false
+	}
+	var keys []string
+	for key := range as {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// a = k*b when each v-free cofactor
+	// of a is k times b's, i.e. when
+	// a_i b_0 = a_0 b_i for every i
+	var num, den Poly
+	for i, key := range keys {
+		ca := as[key]
+		cb, ok := bs[key]
+		if !ok {
+			return nil, false
+		}
+		if i == 0 {
+			num, den = ca, cb
+			continue
+		}
+		diff := add(mul(ca, den), mul(newPoly(map[string]float64{"": -1.}), mul(num, cb)))
+		if len(diff.terms) != 0 {
+			return nil, false
+		}
+	}
+	if len(den.terms) == 1 {
+		return mul(num, asPoly(Pow{den, -1.})), true
+	}
+	return Div{num, den}, true
+}
+
+// splitFree groups the terms of p by their factors
+// involving v, keeping the v-free cofactor of each
+// group as a polynomial, e.g. ax^2+bx^2+x splits
+// into x^2: a+b and x: 1.
+func splitFree(p Poly, v Var) map[string]Poly {
+	groups := make(map[string]Poly)
+	for key, coef := range p.terms {
+		monomials, exponents := decomposePoly(key)
+		var dm, fm []string
+		var de, fe []int
+		for i, m := range monomials {
+			if isConstant(v, indeterminate(m)) {
+				fm, fe = append(fm, m), append(fe, exponents[i])
+			} else {
+				dm, de = append(dm, m), append(de, exponents[i])
+			}
+		}
+		dk := makePolyTerm(dm, de)
+		g, ok := groups[dk]
+		if !ok {
+			g = Poly{make(map[string]float64)}
+			groups[dk] = g
+		}
+		g.terms[makePolyTerm(fm, fe)] += coef
+	}
+	return groups
+}
@@ -0,0 +1,73 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIntegrate(t *testing.T) {
+	x, a := Var{"x"}, Var{"a"}
+	table := []struct {
+		description string
+		e           Expression
+	}{
+		{"polynomial", Add{Mul{Num{3.}, Pow{x, 2.}}, Add{Mul{Num{-2.}, x}, Num{5.}}}},
+		{"expanded power", Pow{Add{x, Num{1.}}, 3.}},
+		{"negative power", Pow{x, -3.}},
+		{"fractional power", Pow{x, .5}},
+		{"quotient", Div{Num{4.}, Pow{x, 2.}}},
+		{"sin of linear", Sin{Add{Mul{Num{3.}, x}, Num{1.}}}},
+		{"cos of linear", Mul{Num{2.}, Cos{Mul{Num{-.5}, x}}}},
+		{"power of linear", Pow{Add{Mul{Num{2.}, x}, Num{1.}}, -2.}},
+		{"u-substitution x Cos(x^2)", Mul{x, Cos{Pow{x, 2.}}}},
+		{"u-substitution Sin(x)^3 Cos(x)", Mul{Pow{Sin{x}, 3.}, Cos{x}}},
+		{"u-substitution x (x^2+1)^-2", Mul{x, Pow{Add{Pow{x, 2.}, Num{1.}}, -2.}}},
+		{"constant factor", Mul{Sin{a}, Mul{Cos{x}, Pow{a, 2.}}}},
+		{"sin of symbolic linear", Sin{Mul{a, x}}},
+		{"cos of symbolic linear", Cos{Add{Mul{Mul{a, Var{"b"}}, x}, Var{"b"}}}},
+		{"u-substitution x Sin(a x^2)", Mul{x, Sin{Mul{a, Pow{x, 2.}}}}},
+		{"u-substitution x Cos(a x^2 + x^2)", Mul{x, Cos{Add{Mul{a, Pow{x, 2.}}, Pow{x, 2.}}}}},
+		{"constant", Cos{a}},
+	}
+	points := []map[string]float64{
+		{"x": .7, "a": 1.3, "b": .2},
+		{"x": 1.9, "a": -.4, "b": 1.1},
+		{"x": 3.1, "a": 2.2, "b": -.6},
+	}
+	for _, tt := range table {
+		f, err := Integrate(tt.e, x)
+		if err != nil {
+			t.Errorf("Integrate %v: %v", tt.description, err)
+			continue
+		}
+		d := PartialDerive(x, f)
+		for _, p := range points {
+			got, want := Eval(d, p), Eval(tt.e, p)
+			if math.Abs(got-want) > 1e-9*(1+math.Abs(want)) {
+				t.Errorf("Integrate %v got %v, derivative %v at %v, want %v",
+					tt.description, Read(f), got, p, want)
+			}
+		}
+	}
+
+	// single variable results check with Derive itself
+	f, err := Integrate(Mul{x, Sin{Pow{x, 2.}}}, x)
+	if err != nil {
+		t.Fatalf("Integrate x Sin(x^2): %v", err)
+	}
+	at := map[string]float64{"x": 1.2}
+	if got, want := Eval(Derive(f), at), 1.2*math.Sin(1.44); !almostEqual(got, want) {
+		t.Errorf("Integrate x Sin(x^2) got %v, derivative %v, want %v", Read(f), got, want)
+	}
+
+	for _, e := range []Expression{
+		Pow{x, -1.},
+		Div{Num{1.}, Add{x, Num{2.}}},
+		Mul{x, Sin{x}},
+		Sin{Pow{x, 2.}},
+	} {
+		if f, err := Integrate(e, x); err == nil {
+			t.Errorf("Integrate %v should fail, got %v", Read(e), Read(f))
+		}
+	}
+}
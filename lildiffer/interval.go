@@ -0,0 +1,520 @@
+package lildiffer
+
+import (
+	"math"
+	"sort"
+)
+
+// An Interval is the closed set of reals between Lo and
+// Hi, either of which may be infinite. Lo > Hi, or either
+// one NaN, makes it empty.
+type Interval struct {
+	Lo, Hi float64
+}
+
+var (
+	emptyInterval = Interval{math.Inf(1), math.Inf(-1)}
+	wholeLine     = Interval{math.Inf(-1), math.Inf(1)}
+)
+
+// IsEmpty reports whether x holds no reals
+func (x Interval) IsEmpty() bool {
+	return !(x.Lo <= x.Hi)
+}
+
+func (x Interval) Contains(f float64) bool {
+	return x.Lo <= f && f <= x.Hi
+}
+
+// Width is Hi - Lo, 0 for an empty x
+func (x Interval) Width() float64 {
+	if x.IsEmpty() {
+		return 0
+	}
+	return x.Hi - x.Lo
+}
+
+// Mid is halfway between Lo and Hi
+func (x Interval) Mid() float64 {
+	return x.Lo + (x.Hi-x.Lo)/2
+}
+
+func point(f float64) Interval {
+	return Interval{f, f}
+}
+
+// Endpoints are rounded outward a ulp past the nearest
+// float, which rounding to nearest never misses. Sums and
+// products are left alone when their rounding error shows
+// they're already on the right side. Library functions like
+// math.Sin are only accurate to a few ulps, so their results
+// are loosened further.
+
+func down(f float64) float64 {
+	return math.Nextafter(f, math.Inf(-1))
+}
+
+func up(f float64) float64 {
+	return math.Nextafter(f, math.Inf(1))
+}
+
+// sumErr is the exact error a + b - s of s = a + b,
+// NaN when the sum overflows
+func sumErr(a, b, s float64) float64 {
+	bb := s - a
+	return (a - (s - bb)) + (b - bb)
+}
+
+func addDown(a, b float64) float64 {
+	s := a + b
+	if sumErr(a, b, s) >= 0 {
+		return s
+	}
+	return down(s)
+}
+
+func addUp(a, b float64) float64 {
+	s := a + b
+	if sumErr(a, b, s) <= 0 {
+		return s
+	}
+	return up(s)
+}
+
+// prodErr is the error a*b - p of p = a*b, NaN when it
+// overflows. Underflow loses it, so tiny products count
+// as inexact either way.
+func prodErr(a, b, p float64) float64 {
+	if math.Abs(p) < 0x1p-1022 {
+		return math.NaN()
+	}
+	return math.FMA(a, b, -p)
+}
+
+// mulDown and mulUp count 0 * Inf as 0, an
+// unbounded endpoint is a limit, not a value
+func mulDown(a, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	p := a * b
+	if prodErr(a, b, p) >= 0 {
+		return p
+	}
+	return down(p)
+}
+
+func mulUp(a, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	p := a * b
+	if prodErr(a, b, p) <= 0 {
+		return p
+	}
+	return up(p)
+}
+
+func loosen(x Interval) Interval {
+	if !math.IsInf(x.Lo, 0) {
+		x.Lo = down(x.Lo - 1e-15*math.Abs(x.Lo))
+	}
+	if !math.IsInf(x.Hi, 0) {
+		x.Hi = up(x.Hi + 1e-15*math.Abs(x.Hi))
+	}
+	return x
+}
+
+func hull(xs ...Interval) Interval {
+	r := emptyInterval
+	for _, x := range xs {
+		if x.IsEmpty() {
+			continue
+		}
+		r.Lo, r.Hi = math.Min(r.Lo, x.Lo), math.Max(r.Hi, x.Hi)
+	}
+	return r
+}
+
+func intersect(x, y Interval) Interval {
+	r := Interval{math.Max(x.Lo, y.Lo), math.Min(x.Hi, y.Hi)}
+	if r.IsEmpty() || x.IsEmpty() || y.IsEmpty() {
+		return emptyInterval
+	}
+	return r
+}
+
+func addInterval(x, y Interval) Interval {
+	if x.IsEmpty() || y.IsEmpty() {
+		return emptyInterval
+	}
+	return Interval{addDown(x.Lo, y.Lo), addUp(x.Hi, y.Hi)}
+}
+
+func negInterval(x Interval) Interval {
+	return Interval{-x.Hi, -x.Lo}
+}
+
+func mulInterval(x, y Interval) Interval {
+	if x.IsEmpty() || y.IsEmpty() {
+		return emptyInterval
+	}
+	r := Interval{math.Inf(1), math.Inf(-1)}
+	for _, a := range []float64{x.Lo, x.Hi} {
+		for _, b := range []float64{y.Lo, y.Hi} {
+			r.Lo, r.Hi = math.Min(r.Lo, mulDown(a, b)), math.Max(r.Hi, mulUp(a, b))
+		}
+	}
+	return r
+}
+
+// extendedDiv divides x by y as sets. Dividing by an
+// interval with zero strictly inside splits the result
+// in two, dividing by exactly zero leaves nothing.
+func extendedDiv(x, y Interval) []Interval {
+	if x.IsEmpty() || y.IsEmpty() || (y.Lo == 0 && y.Hi == 0) {
+		return nil
+	}
+	if !y.Contains(0) {
+		return []Interval{mulInterval(x, Interval{down(1 / y.Hi), up(1 / y.Lo)})}
+	}
+	if x.Contains(0) {
+		return []Interval{wholeLine}
+	}
+	inf := math.Inf(1)
+	if x.Lo > 0 {
+		switch {
+		case y.Lo == 0:
+			return []Interval{{down(x.Lo / y.Hi), inf}}
+		case y.Hi == 0:
+			return []Interval{{-inf, up(x.Lo / y.Lo)}}
+		}
+		return []Interval{{-inf, up(x.Lo / y.Lo)}, {down(x.Lo / y.Hi), inf}}
+	}
+	switch {
+	case y.Lo == 0:
+		return []Interval{{-inf, up(x.Hi / y.Hi)}}
+	case y.Hi == 0:
+		return []Interval{{down(x.Hi / y.Lo), inf}}
+	}
+	return []Interval{{-inf, up(x.Hi / y.Hi)}, {down(x.Hi / y.Lo), inf}}
+}
+
+// powRound is x^n for x >= 0 by repeated squaring,
+// rounding every product with mul
+func powRound(x float64, n int, mul func(a, b float64) float64) float64 {
+	r := 1.
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			r = mul(r, x)
+		}
+		x = mul(x, x)
+	}
+	return r
+}
+
+// ipowInterval is x^n for n >= 0. Odd powers are
+// monotone, even ones fold the negative half over.
+func ipowInterval(x Interval, n int) Interval {
+	if x.IsEmpty() {
+		return x
+	}
+	if n == 0 {
+		return point(1)
+	}
+	lo, hi := mulDown, mulUp
+	if n%2 == 1 {
+		lower := x.Lo
+		if lower < 0 {
+			lower = -powRound(-lower, n, hi)
+		} else {
+			lower = powRound(lower, n, lo)
+		}
+		upper := x.Hi
+		if upper < 0 {
+			upper = -powRound(-upper, n, lo)
+		} else {
+			upper = powRound(upper, n, hi)
+		}
+		return Interval{lower, upper}
+	}
+	switch {
+	case x.Lo >= 0:
+		return Interval{powRound(x.Lo, n, lo), powRound(x.Hi, n, hi)}
+	case x.Hi <= 0:
+		return Interval{powRound(-x.Hi, n, lo), powRound(-x.Lo, n, hi)}
+	}
+	return Interval{0, powRound(math.Max(-x.Lo, x.Hi), n, hi)}
+}
+
+// reaches reports whether x holds c + 2kπ for some
+// integer k, erring toward yes near its ends
+func reaches(x Interval, c float64) bool {
+	k := math.Ceil((x.Lo-c)/(2*math.Pi) - 1e-9)
+	return c+2*math.Pi*k <= x.Hi+1e-9*(1+math.Abs(x.Hi))
+}
+
+// periodic encloses a sine like f over x, given where
+// in its 2π period it peaks and where it bottoms out.
+// Between those it's monotone, so the ends decide.
+func periodic(x Interval, f func(float64) float64, peak, trough float64) Interval {
+	if x.IsEmpty() {
+		return x
+	}
+	// past 2^50 floats are too coarse
+	// to tell where in its period x is
+	if x.Width() >= 2*math.Pi || math.Abs(x.Lo) > 1<<50 || math.Abs(x.Hi) > 1<<50 {
+		return Interval{-1, 1}
+	}
+	a, b := f(x.Lo), f(x.Hi)
+	r := loosen(Interval{math.Min(a, b), math.Max(a, b)})
+	if reaches(x, peak) {
+		r.Hi = 1
+	}
+	if reaches(x, trough) {
+		r.Lo = -1
+	}
+	return intersect(r, Interval{-1, 1})
+}
+
+// intervalEvaluator encloses expressions
+// over a box of variable bounds
+type intervalEvaluator struct {
+	box map[string]Interval
+	// singular is set once some point of the box might
+	// be outside e's domain, like a zero denominator,
+	// where e needn't be continuous
+	singular bool
+}
+
+func (ev *intervalEvaluator) div(x, y Interval) Interval {
+	if y.Contains(0) {
+		ev.singular = true
+	}
+	return hull(extendedDiv(x, y)...)
+}
+
+func (ev *intervalEvaluator) pow(x Interval, p float64) Interval {
+	if isInteger(p) {
+		if p < 0 {
+			return ev.div(point(1), ipowInterval(x, int(-p)))
+		}
+		return ipowInterval(x, int(p))
+	}
+	// fractional powers are only defined
+	// from 0 up, the rest is left out
+	if x.Lo < 0 {
+		ev.singular = true
+		x = intersect(x, Interval{0, math.Inf(1)})
+	}
+	if x.IsEmpty() {
+		return x
+	}
+	if p < 0 {
+		if x.Lo == 0 {
+			ev.singular = true
+		}
+		return loosen(Interval{math.Pow(x.Hi, p), math.Pow(x.Lo, p)})
+	}
+	return loosen(Interval{math.Pow(x.Lo, p), math.Pow(x.Hi, p)})
+}
+
+func (ev *intervalEvaluator) eval(e Expression) Interval {
+	switch v := e.(type) {
+	case con:
+		return ev.eval(v.E1)
+	case polyWrt:
+		return ev.eval(v.P)
+	case Num:
+		return point(v.Val)
+	case Var:
+		x, ok := ev.box[v.Name]
+		if !ok {
+			panic("unbound variable " + v.Name)
+		}
+		return x
+	case Poly:
+		r := point(0)
+		for key, coef := range v.terms {
+			t := point(coef)
+			monomials, exponents := decomposePoly(key)
+			for i, m := range monomials {
+				t = mulInterval(t, ev.pow(ev.eval(indeterminate(m)), float64(exponents[i])))
+			}
+			r = addInterval(r, t)
+		}
+		return r
+	case Cos:
+		return periodic(ev.eval(v.E1), math.Cos, 0, math.Pi)
+	case Sin:
+		return periodic(ev.eval(v.E1), math.Sin, math.Pi/2, -math.Pi/2)
+	case Pow:
+		return ev.pow(ev.eval(v.Base), v.Exponent)
+	case Div:
+		return ev.div(ev.eval(v.E1), ev.eval(v.E2))
+	case Mul:
+		return mulInterval(ev.eval(v.E1), ev.eval(v.E2))
+	case Add:
+		return addInterval(ev.eval(v.E1), ev.eval(v.E2))
+	case UndefinedFunction:
+		panic("can't evaluate undefined function " + v.Name)
+	case Derivative:
+		panic("can't evaluate unevaluated derivative " + Read(v))
+	case At:
+		inner := intervalEvaluator{box: make(map[string]Interval, len(ev.box)+len(v.Vars))}
+		for k, x := range ev.box {
+			inner.box[k] = x
+		}
+		for i, w := range v.Vars {
+			inner.box[w.Name] = ev.eval(v.Vals[i])
+		}
+		r := inner.eval(v.F)
+		ev.singular = ev.singular || inner.singular
+		return r
+	}
+	panic("interval eval tried to reach undefined type in tree")
+}
+
+// EvalInterval encloses the values e takes as its variables
+// range over box: every finite Eval(e, p) with p in box lies
+// in the result. Points where e is undefined, like negative
+// bases of fractional powers, are left out, so the
+// enclosure can be empty. It panics on a variable box
+// doesn't bind.
+func EvalInterval(e Expression, box map[string]Interval) Interval {
+	ev := intervalEvaluator{box: box}
+	return ev.eval(e)
+}
+
+// EvalMeanValue encloses e over box like EvalInterval, but
+// with the mean value form f(c) + Σ ∂f/∂v(box) (v - c) about
+// the box's midpoint c, intersected with the plain
+// enclosure. Its overestimate shrinks with the square of
+// the box's width rather than linearly, so it's much
+// tighter on small boxes. Where e might be discontinuous
+// in box it falls back to the plain enclosure.
+func EvalMeanValue(e Expression, box map[string]Interval) Interval {
+	ev := intervalEvaluator{box: box}
+	natural := ev.eval(e)
+	if ev.singular {
+		return natural
+	}
+	center := make(map[string]Interval)
+	for name, x := range box {
+		if math.IsInf(x.Lo, 0) || math.IsInf(x.Hi, 0) {
+			return natural
+		}
+		center[name] = point(x.Mid())
+	}
+	r := EvalInterval(e, center)
+	for _, v := range Variables(e) {
+		d := EvalInterval(PartialDerive(v, e), box)
+		offset := addInterval(box[v.Name], negInterval(center[v.Name]))
+		r = addInterval(r, mulInterval(d, offset))
+	}
+	return intersect(r, natural)
+}
+
+// A RootEnclosure is an interval that may hold a zero,
+// unless Unique, in which case it provably holds exactly
+// one for every value of the other variables.
+type RootEnclosure struct {
+	Interval
+	Unique bool
+}
+
+// IntervalNewton encloses every zero of e in x, as a
+// function of v, with e's other variables ranging over
+// env. Intervals no wider than tol that can't be told
+// apart, like around a double root, come back merged and
+// not Unique. Enclosures that aren't Unique may hold no
+// zero at all, but zeros outside all the enclosures
+// returned provably don't exist. It panics on an unbounded x.
+func IntervalNewton(e Expression, v Var, x Interval, env map[string]Interval, tol float64) []RootEnclosure {
+	if math.IsInf(x.Lo, 0) || math.IsInf(x.Hi, 0) {
+		panic("interval newton needs a bounded interval")
+	}
+	d := Simplify(PartialDerive(v, e))
+	eval := func(e Expression, x Interval) (Interval, bool) {
+		box := map[string]Interval{v.Name: x}
+		for name, y := range env {
+			if name != v.Name {
+				box[name] = y
+			}
+		}
+		ev := intervalEvaluator{box: box}
+		r := ev.eval(e)
+		return r, ev.singular
+	}
+
+	var found []RootEnclosure
+	work := []RootEnclosure{{x, false}}
+	const maxSteps = 10000
+	for steps := 0; len(work) > 0 && steps < maxSteps; steps++ {
+		y := work[len(work)-1]
+		work = work[:len(work)-1]
+		fy, singular := eval(e, y.Interval)
+		if !fy.Contains(0) {
+			continue
+		}
+		// floats run out before a tol
+		// that's too small is reached
+		m := y.Mid()
+		if y.Width() <= tol || m <= y.Lo || m >= y.Hi {
+			found = append(found, y)
+			continue
+		}
+
+		// N = m - f(m) / f'(y) holds every zero in y, as
+		// long as e is smooth on y and defined at m
+		dy, dsingular := eval(d, y.Interval)
+		fm, _ := eval(e, point(m))
+		next := []RootEnclosure{y}
+		if !singular && !dsingular && !fm.IsEmpty() {
+			next = nil
+			for _, q := range extendedDiv(fm, dy) {
+				n := addInterval(point(m), negInterval(q))
+				z := intersect(y.Interval, n)
+				if z.IsEmpty() {
+					continue
+				}
+				// N inside y and f' keeping its
+				// sign prove a single zero
+				unique := y.Unique || (!dy.Contains(0) && n.Lo > y.Lo && n.Hi < y.Hi)
+				next = append(next, RootEnclosure{z, unique})
+			}
+		}
+		width := 0.
+		for _, z := range next {
+			width += z.Width()
+		}
+		if width <= y.Width()/2 {
+			work = append(work, next...)
+			continue
+		}
+		// too little progress, bisect instead
+		for _, z := range next {
+			m := z.Mid()
+			work = append(work,
+				RootEnclosure{Interval{z.Lo, m}, false},
+				RootEnclosure{Interval{m, z.Hi}, false})
+		}
+	}
+	// whatever's left after maxSteps
+	// still might hold zeros
+	found = append(found, work...)
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Lo < found[j].Lo
+	})
+	var merged []RootEnclosure
+	for _, r := range found {
+		if k := len(merged) - 1; k >= 0 && r.Lo <= merged[k].Hi {
+			merged[k].Hi = math.Max(merged[k].Hi, r.Hi)
+			merged[k].Unique = false
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,149 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether got encloses want, with
+// ends no more than 1e-9 further out
+func near(got, want Interval) bool {
+	if want.IsEmpty() {
+		return got.IsEmpty()
+	}
+	end := func(g, w float64) bool {
+		if math.IsInf(w, 0) {
+			return g == w
+		}
+		return math.Abs(g-w) <= 1e-9
+	}
+	return got.Lo <= want.Lo && want.Hi <= got.Hi &&
+		end(got.Lo, want.Lo) && end(got.Hi, want.Hi)
+}
+
+func TestEvalInterval(t *testing.T) {
+	type ptype map[string]float64
+	x, y := Var{"x"}, Var{"y"}
+	inf := math.Inf(1)
+	table := []struct {
+		description string
+		e           Expression
+		x           Interval
+		want        Interval
+	}{
+		{"sin peak inside", Sin{x}, Interval{0, 3}, Interval{0, 1}},
+		{"sin monotone", Sin{x}, Interval{2, 4}, Interval{math.Sin(4), math.Sin(2)}},
+		{"cos trough at pi", Cos{x}, Interval{3, 4}, Interval{-1, math.Cos(4)}},
+		{"cos peak at 2pi", Cos{x}, Interval{5, 7}, Interval{math.Cos(5), 1}},
+		{"cos full period", Cos{x}, Interval{-1, 7}, Interval{-1, 1}},
+		{"sin far out", Sin{x}, Interval{1e6, 1e6 + 1}, Interval{math.Sin(1e6), math.Sin(1e6 + 1)}},
+		{"even power", Pow{x, 2.}, Interval{-2, 1}, Interval{0, 4}},
+		{"odd power", Pow{x, 3.}, Interval{-2, 1}, Interval{-8, 1}},
+		{"even power negative", Pow{x, 4.}, Interval{-3, -1}, Interval{1, 81}},
+		{"negative even power through 0", Pow{x, -2.}, Interval{-2, 1}, Interval{.25, inf}},
+		{"negative odd power through 0", Pow{x, -1.}, Interval{-2, 1}, wholeLine},
+		{"negative power", Pow{x, -1.}, Interval{1, 2}, Interval{.5, 1}},
+		{"square root clipped", Pow{x, .5}, Interval{-4, 9}, Interval{0, 3}},
+		{"square root undefined", Pow{x, .5}, Interval{-4, -1}, emptyInterval},
+		{"divide by 0 at an end", Div{Num{1.}, x}, Interval{0, 2}, Interval{.5, inf}},
+		{"divide by 0 at the other", Div{Num{-1.}, x}, Interval{-2, 0}, Interval{.5, inf}},
+		{"divide by exactly 0", Div{Num{1.}, Mul{Num{0.}, x}}, Interval{1, 2}, emptyInterval},
+		{"poly repeats x", newPoly(ptype{"x^2": 1, "x": -2}), Interval{0, 2}, Interval{-4, 4}},
+		{"poly atom", newPoly(ptype{polyName(Sin{x}) + "^2": 1}), Interval{-1, 1}, Interval{0, math.Pow(math.Sin(1), 2)}},
+		{"two variables", Add{Mul{x, y}, y}, Interval{-1, 2}, Interval{0, 3}},
+	}
+	for _, tt := range table {
+		box := map[string]Interval{"x": tt.x, "y": {1, 1}}
+		if got := EvalInterval(tt.e, box); !near(got, tt.want) {
+			t.Errorf("EvalInterval %v over %v got %v, want %v", tt.description, tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestEvalMeanValue(t *testing.T) {
+	type ptype map[string]float64
+	// x^2 - 2x is [-1, -.99] on [.9, 1.1], where
+	// the plain enclosure is [-1.39, -.59]
+	var e Expression = newPoly(ptype{"x^2": 1, "x": -2})
+	box := map[string]Interval{"x": {.9, 1.1}}
+	natural, mv := EvalInterval(e, box), EvalMeanValue(e, box)
+	if !mv.Contains(-1) || !mv.Contains(-.99) || mv.Width() > .05 || mv.Width() >= natural.Width() {
+		t.Errorf("EvalMeanValue got %v, plain %v, want about [-1.02, -.98]", mv, natural)
+	}
+	// 1/x is singular on [-1, 1], the mean value
+	// form doesn't apply there
+	e = Div{Num{1.}, Var{"x"}}
+	box = map[string]Interval{"x": {-1, 1}}
+	if got := EvalMeanValue(e, box); got != EvalInterval(e, box) {
+		t.Errorf("EvalMeanValue of 1/x on [-1, 1] got %v, want %v", got, EvalInterval(e, box))
+	}
+}
+
+// Every value the generator's expressions take at points
+// of a box lies in their enclosures. Points are evaluated
+// with outward rounding too, so the exact value lies in
+// both and they have to overlap.
+func TestIntervalEnclosesProperty(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	g := newGenerator(50, x, y)
+	for i := 0; i < 500; i++ {
+		e := g.expression(4)
+		box := make(map[string]Interval)
+		for _, v := range g.vars {
+			c, w := 2*g.r.Float64()-1, g.r.Float64()/2
+			box[v.Name] = Interval{c - w, c + w}
+		}
+		natural, mv := EvalInterval(e, box), EvalMeanValue(e, box)
+		for j := 0; j < 20; j++ {
+			p := make(map[string]float64)
+			for _, v := range g.vars {
+				b := box[v.Name]
+				p[v.Name] = b.Lo + g.r.Float64()*b.Width()
+			}
+			pbox := make(map[string]Interval)
+			for name, f := range p {
+				pbox[name] = point(f)
+			}
+			f := EvalInterval(e, pbox)
+			if f.IsEmpty() {
+				continue
+			}
+			for _, r := range []Interval{natural, mv} {
+				if f.Lo > r.Hi || f.Hi < r.Lo {
+					t.Errorf("%v is %v at %v, outside %v", Read(e), f, p, r)
+				}
+			}
+		}
+	}
+}
+
+func TestIntervalNewton(t *testing.T) {
+	x, p := Var{"x"}, Var{"p"}
+	table := []struct {
+		description string
+		e           Expression
+		x           Interval
+		roots       []float64
+		unique      bool
+	}{
+		{"x^2 - 2", Add{Pow{x, 2.}, Num{-2.}}, Interval{0, 3}, []float64{math.Sqrt2}, true},
+		{"sin(x)", Sin{x}, Interval{1, 10}, []float64{math.Pi, 2 * math.Pi, 3 * math.Pi}, true},
+		{"x^2 + 1", Add{Pow{x, 2.}, Num{1.}}, Interval{-5, 5}, nil, true},
+		{"double root", Pow{Add{x, Num{-1.}}, 2.}, Interval{0, 3}, []float64{1}, false},
+		{"past a pole", Add{Div{Num{1.}, x}, Num{-.5}}, Interval{-1, 3}, []float64{2}, true},
+		{"parameter", Add{Mul{p, x}, Num{-1.}}, Interval{-1, 1}, []float64{.5}, true},
+	}
+	env := map[string]Interval{"p": {2, 2}}
+	for _, tt := range table {
+		got := IntervalNewton(tt.e, x, tt.x, env, 1e-10)
+		if len(got) != len(tt.roots) {
+			t.Errorf("IntervalNewton %v got %v, want enclosures of %v", tt.description, got, tt.roots)
+			continue
+		}
+		for i, r := range got {
+			if !r.Contains(tt.roots[i]) || r.Width() > 1e-9 || r.Unique != tt.unique {
+				t.Errorf("IntervalNewton %v got %v, want %v enclosed, unique %v", tt.description, r, tt.roots[i], tt.unique)
+			}
+		}
+	}
+}
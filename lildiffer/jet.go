@@ -0,0 +1,160 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// A Jet holds the leading Taylor coefficients of a
+// function of one variable about a point,
+// c[k] = f^(k)(a) / k!.
+type Jet []float64
+
+// Derivative is the kth derivative at the point.
+func (j Jet) Derivative(k int) float64 {
+	d := j[k]
+	for i := 2; i <= k; i++ {
+		d *= float64(i)
+	}
+	return d
+}
+
+// EvalJet propagates Taylor coefficients through e in one
+// pass, expanding in v about point[v] to the given order.
+// Every other variable is held at its value in point.
+// Much cheaper than differentiating symbolically order
+// times.
+func EvalJet(e Expression, v Var, point map[string]float64, order int) Jet {
+	n := order + 1
+	f := func(e Expression) Jet {
+		return EvalJet(e, v, point, order)
+	}
+	switch w := e.(type) {
+	case con:
+		return f(w.E1)
+	case polyWrt:
+		return f(w.P)
+	case Num:
+		return constJet(w.Val, n)
+	case Var:
+		j := constJet(Eval(w, point), n)
+		if w == v && n > 1 {
+			j[1] = 1
+		}
+		return j
+	case Poly:
+		r := constJet(0, n)
+		for key, coef := range w.terms {
+			t := constJet(coef, n)
+			monomials, exponents := decomposePoly(key)
+			for i, m := range monomials {
+				t = t.mul(f(indeterminate(m)).ipow(exponents[i]))
+			}
+			r = r.add(t)
+		}
+		return r
+	case Add:
+		return f(w.E1).add(f(w.E2))
+	case Mul:
+		return f(w.E1).mul(f(w.E2))
+	case Div:
+		return f(w.E1).div(f(w.E2))
+	case Pow:
+		a := f(w.Base)
+		if isInteger(w.Exponent) {
+			return a.ipow(int(w.Exponent))
+		}
+		return a.pow(w.Exponent)
+	case Sin:
+		s, _ := f(w.E1).sincos()
+		return s
+	case Cos:
+		_, c := f(w.E1).sincos()
+		return c
+	}
+	panic("jet tried to reach undefined type in tree")
+}
+
+func constJet(c float64, n int) Jet {
+	j := make(Jet, n)
+	j[0] = c
+	return j
+}
+
+func (a Jet) add(b Jet) Jet {
+	r := make(Jet, len(a))
+	for k := range r {
+		r[k] = a[k] + b[k]
+	}
+	return r
+}
+
+// Cauchy product
+func (a Jet) mul(b Jet) Jet {
+	r := make(Jet, len(a))
+	for k := range r {
+		for j := 0; j <= k; j++ {
+			r[k] += a[j] * b[k-j]
+		}
+	}
+	return r
+}
+
+// a = r*b solved for r term by term
+func (a Jet) div(b Jet) Jet {
+	r := make(Jet, len(a))
+	for k := range r {
+		s := a[k]
+		for j := 1; j <= k; j++ {
+			s -= b[j] * r[k-j]
+		}
+		r[k] = s / b[0]
+	}
+	return r
+}
+
+// integer powers by repeated squaring, which
+// unlike pow copes with a[0] == 0
+func (a Jet) ipow(n int) Jet {
+	if n < 0 {
+		return constJet(1, len(a)).div(a.ipow(-n))
+	}
+	r := constJet(1, len(a))
+	for n > 0 {
+		if n&1 == 1 {
+			r = r.mul(a)
+		}
+		a = a.mul(a)
+		n >>= 1
+	}
+	return r
+}
+
+// real powers from b' a = p a' b
+func (a Jet) pow(p float64) Jet {
+	b := make(Jet, len(a))
+	b[0] = math.Pow(a[0], p)
+	for k := 1; k < len(b); k++ {
+		s := 0.
+		for j := 1; j <= k; j++ {
+			s += ((p+1)*float64(j) - float64(k)) * a[j] * b[k-j]
+		}
+		b[k] = s / (float64(k) * a[0])
+	}
+	return b
+}
+
+// from s' = c a' and c' = -s a'
+func (a Jet) sincos() (Jet, Jet) {
+	s := make(Jet, len(a))
+	c := make(Jet, len(a))
+	s[0], c[0] = math.Sincos(a[0])
+	for k := 1; k < len(a); k++ {
+		for j := 1; j <= k; j++ {
+			s[k] += float64(j) * a[j] * c[k-j]
+			c[k] -= float64(j) * a[j] * s[k-j]
+		}
+		s[k] /= float64(k)
+		c[k] /= float64(k)
+	}
+	return s, c
+}
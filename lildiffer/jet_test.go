@@ -0,0 +1,49 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvalJet(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	point := map[string]float64{"x": .3, "y": 2.}
+	jet := EvalJet(Sin{x}, x, point, 20)
+	table := []struct {
+		k    int
+		want float64
+	}{
+		{0, math.Sin(.3)},
+		{1, math.Cos(.3)},
+		{19, -math.Cos(.3)},
+		{20, math.Sin(.3)},
+	}
+	for _, tt := range table {
+		if got := jet.Derivative(tt.k); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("d^%v/dx^%v sin(x) got %v, want %v", tt.k, tt.k, got, tt.want)
+		}
+	}
+
+	// agree with symbolic derivatives on every node type
+	f := Add{
+		Div{Mul{y, Cos{Pow{x, 2.}}}, Add{Num{1.}, Pow{x, 2.}}},
+		Add{Pow{Add{x, Num{2.}}, 1.5}, makePoly(Mul{Sin{x}, Add{x, y}})},
+	}
+	jet = EvalJet(f, x, point, 6)
+	for k := 0; k <= 6; k++ {
+		want := Eval(NthDerivative(f, x, k), point)
+		if got := jet.Derivative(k); math.Abs(got-want) > 1e-8*math.Max(1, math.Abs(want)) {
+			t.Errorf("jet derivative %v got %v, want %v", k, got, want)
+		}
+	}
+
+	// x^3 at 0 needs integer powers
+	jet = EvalJet(Pow{x, 3.}, x, map[string]float64{"x": 0}, 4)
+	want := Jet{0, 0, 0, 1, 0}
+	for k := range want {
+		if jet[k] != want[k] {
+			t.Errorf("x^3 jet got %v, want %v", jet, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// multipliers names one multiplier per constraint,
+// prefix1, prefix2, ..., skipping the names of taken
+func multipliers(prefix string, n int, taken []Var) []Var {
+	used := make(map[string]bool)
+	for _, v := range taken {
+		used[v.Name] = true
+	}
+	vs := make([]Var, 0, n)
+	for k := 1; len(vs) < n; k++ {
+		if name := prefix + strconv.Itoa(k); !used[name] {
+			vs = append(vs, Var{name})
+		}
+	}
+	return vs
+}
+
+// Lagrangian returns f + sum of lambdai * cons[i]
+// along with the multipliers lambda1, lambda2, ...
+// A name already a variable of f or cons is skipped.
+func Lagrangian(f Expression, cons []Expression) (Expression, []Var) {
+	taken := Variables(f)
+	for _, g := range cons {
+		taken = append(taken, Variables(g)...)
+	}
+	lambdas := multipliers("lambda", len(cons), taken)
+	l := f
+	for i, g := range cons {
+		l = Add{l, Mul{lambdas[i], g}}
+	}
+	return l, lambdas
+}
+
+// StationarySystem returns the partials of the
+// Lagrangian of f and cons in vars and in its
+// multipliers, whose common zeros are the
+// constrained critical points, along with all
+// the unknowns: vars then multipliers.
+func StationarySystem(f Expression, cons []Expression, vars []Var) ([]Expression, []Var) {
+	l, lambdas := Lagrangian(f, cons)
+	unknowns := append(append([]Var(nil), vars...), lambdas...)
+	return Gradient(l, unknowns), unknowns
+}
+
+// A LagrangeResult is a constrained critical
+// point found numerically.
+type LagrangeResult struct {
+	// X binds vars and any other
+	// variables of the start
+	X map[string]float64
+	// one per constraint, equalities first
+	Multipliers []float64
+	F           float64
+	// Residual is the 2-norm of the
+	// stationarity system at X
+	Residual   float64
+	Iterations int
+	Converged  bool
+}
+
+// LagrangeNewton finds a critical point of f subject to
+// cons = 0 by running Newton on the stationarity system,
+// from start with every multiplier at 0. The point found
+// may be a minimum, a maximum or a saddle; compare F
+// across starts, or use LagrangeSolve for polynomial
+// problems to get them all.
+func LagrangeNewton(f Expression, cons []Expression, vars []Var, start map[string]float64, tol float64, maxIter int) LagrangeResult {
+	fs, unknowns := StationarySystem(f, cons, vars)
+	x := make(map[string]float64, len(start)+len(cons))
+	for k, v := range start {
+		x[k] = v
+	}
+	for _, l := range unknowns[len(vars):] {
+		x[l.Name] = 0
+	}
+	r := Newton(fs, unknowns, x, tol, maxIter)
+	ms := make([]float64, len(cons))
+	for i, l := range unknowns[len(vars):] {
+		ms[i] = r.X[l.Name]
+		delete(r.X, l.Name)
+	}
+	return LagrangeResult{r.X, ms, Eval(f, r.X), r.Residual, r.Iterations, r.Converged}
+}
+
+// LagrangeSolve finds every real constrained critical point
+// of f subject to cons = 0 when the stationarity system is
+// polynomial with numeric coefficients. A lex Groebner basis
+// triangularizes the system, which is then solved one
+// unknown at a time from the last, through the closed forms
+// of Solve. Solutions bind vars and the multipliers, sorted
+// by increasing f, so the first is the constrained minimum.
+func LagrangeSolve(f Expression, cons []Expression, vars []Var) ([]Solution, error) {
+	fs, unknowns := StationarySystem(f, cons, vars)
+	names := make([]string, len(unknowns))
+	index := make(map[string]bool)
+	for i, v := range unknowns {
+		names[i] = polyName(v)
+		index[names[i]] = true
+	}
+	var ps []RatPoly
+	for _, e := range fs {
+		p := polyOf(e)
+		for key := range p.terms {
+			monomials, exponents := decomposePoly(key)
+			for i, m := range monomials {
+				if !index[m] || exponents[i] < 0 {
+					return nil, fmt.Errorf("stationarity system isn't polynomial in the unknowns: %v", Read(p))
+				}
+			}
+		}
+		ps = append(ps, ToRatPoly(p))
+	}
+	basis := GroebnerBasis(ps, Lex(unknowns...))
+	for _, g := range basis {
+		if _, ok := constantOf(g.Poly()); ok {
+			// inconsistent, the ideal is everything
+			return nil, nil
+		}
+	}
+
+	// back substitute from the last unknown
+	partials := []map[string]float64{{}}
+	for k := len(names) - 1; k >= 0; k-- {
+		var next []map[string]float64
+		for _, vals := range partials {
+			var cands [][]float64
+			for _, g := range basis {
+				cs, ok := univariate(g.Poly(), names[k], names[k+1:], vals)
+				if !ok {
+					continue
+				}
+				cands = append(cands, cs)
+			}
+			roots, err := commonRoots(cands)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", unknowns[k].Name, err)
+			}
+			for _, r := range roots {
+				m := map[string]float64{names[k]: r}
+				for key, val := range vals {
+					m[key] = val
+				}
+				next = append(next, m)
+			}
+		}
+		partials = next
+	}
+
+	var solutions []Solution
+	var values []float64
+	for _, vals := range partials {
+		s := make(Solution)
+		env := make(map[string]float64)
+		for i, v := range unknowns {
+			s[v] = Num{vals[names[i]]}
+			env[v.Name] = vals[names[i]]
+		}
+		solutions = append(solutions, s)
+		values = append(values, Eval(f, env))
+	}
+	sort.Sort(byValue{solutions, values})
+	return solutions, nil
+}
+
+type byValue struct {
+	s []Solution
+	v []float64
+}
+
+func (b byValue) Len() int           { return len(b.s) }
+func (b byValue) Less(i, j int) bool { return b.v[i] < b.v[j] }
+func (b byValue) Swap(i, j int) {
+	b.s[i], b.s[j] = b.s[j], b.s[i]
+	b.v[i], b.v[j] = b.v[j], b.v[i]
+}
+
+// univariate substitutes vals for the names in later
+// into p, returning its coefficients in name, constant
+// first. ok is false when p involves other names, or
+// doesn't involve name at all.
+func univariate(p Poly, name string, later []string, vals map[string]float64) ([]float64, bool) {
+	allowed := make(map[string]bool)
+	for _, n := range later {
+		allowed[n] = true
+	}
+	var cs []float64
+	found := false
+	for key, coef := range p.terms {
+		n := 0
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			switch {
+			case m == name:
+				n = exponents[i]
+				found = true
+			case allowed[m]:
+				coef *= math.Pow(vals[m], float64(exponents[i]))
+			default:
+				return nil, false
+			}
+		}
+		for len(cs) <= n {
+			cs = append(cs, 0)
+		}
+		cs[n] += coef
+	}
+	return cs, found
+}
+
+// commonRoots solves the first polynomial in cs that
+// doesn't vanish identically and keeps the roots the
+// others share.
+func commonRoots(cs [][]float64) ([]float64, error) {
+	nonzero := func(c []float64) bool {
+		for _, x := range c[1:] {
+			if !almostEqual(x, 0.) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, c := range cs {
+		if !nonzero(c) {
+			continue
+		}
+		roots, err := realRoots(c)
+		if err != nil {
+			return nil, err
+		}
+		var common []float64
+	root:
+		for _, r := range roots {
+			for _, d := range cs[i+1:] {
+				val := 0.
+				for j := len(d) - 1; j >= 0; j-- {
+					val = val*r + d[j]
+				}
+				if math.Abs(val) > 1e-6 {
+					continue root
+				}
+			}
+			common = append(common, r)
+		}
+		return common, nil
+	}
+	return nil, fmt.Errorf("infinitely many critical points")
+}
+
+// inequalities KKT will enumerate
+// the active sets of
+const maxActiveSets = 20
+
+// KKT minimizes f subject to eqs = 0 and ineqs <= 0 by
+// enumerating active sets: each subset of ineqs is held as
+// equalities and solved with LagrangeNewton from start, and
+// the point is kept if the inactive inequalities hold and
+// the active ones have nonnegative multipliers. The best
+// such point is returned, an error if there is none. The
+// enumeration is exponential, meant for a handful of
+// inequalities; more than maxActiveSets is an error.
+func KKT(f Expression, eqs, ineqs []Expression, vars []Var, start map[string]float64, tol float64, maxIter int) (LagrangeResult, error) {
+	if len(ineqs) > maxActiveSets {
+		return LagrangeResult{}, fmt.Errorf("KKT enumerates active sets, %v inequalities is more than %v", len(ineqs), maxActiveSets)
+	}
+	best := LagrangeResult{F: math.Inf(1)}
+	found := false
+	for set := 0; set < 1<<len(ineqs); set++ {
+		cons := append([]Expression(nil), eqs...)
+		var active []int
+		for i := range ineqs {
+			if set&(1<<i) != 0 {
+				cons = append(cons, ineqs[i])
+				active = append(active, i)
+			}
+		}
+		if len(cons) > len(vars) {
+			continue
+		}
+		r := LagrangeNewton(f, cons, vars, start, tol, maxIter)
+		if !r.Converged || !feasible(r, ineqs, active, len(eqs), tol) {
+			continue
+		}
+		ms := make([]float64, len(eqs)+len(ineqs))
+		copy(ms, r.Multipliers[:len(eqs)])
+		for j, i := range active {
+			ms[len(eqs)+i] = r.Multipliers[len(eqs)+j]
+		}
+		r.Multipliers = ms
+		if r.F < best.F {
+			best, found = r, true
+		}
+	}
+	if !found {
+		return best, fmt.Errorf("no KKT point found from %v", start)
+	}
+	return best, nil
+}
+
+// feasible checks the inactive inequalities hold
+// and the active ones pull the right way
+func feasible(r LagrangeResult, ineqs []Expression, active []int, neq int, tol float64) bool {
+	isActive := make(map[int]bool)
+	for j, i := range active {
+		isActive[i] = true
+		if r.Multipliers[neq+j] < -math.Sqrt(tol) {
+			return false
+		}
+	}
+	for i, h := range ineqs {
+		if !isActive[i] && Eval(h, r.X) > math.Sqrt(tol) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLagrangeNewton(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	// closest point to (2, 1) on the unit circle
+	f := Add{Pow{Add{x, Num{-2.}}, 2.}, Pow{Add{y, Num{-1.}}, 2.}}
+	circle := Add{Pow{x, 2.}, Add{Pow{y, 2.}, Num{-1.}}}
+	r := LagrangeNewton(f, []Expression{circle}, []Var{x, y},
+		map[string]float64{"x": 1, "y": 1}, 1e-12, 50)
+	s5 := math.Sqrt(5)
+	if !r.Converged || math.Abs(r.X["x"]-2/s5) > 1e-9 || math.Abs(r.X["y"]-1/s5) > 1e-9 {
+		t.Errorf("LagrangeNewton got %+v, want (%v, %v)", r, 2/s5, 1/s5)
+	}
+	if want := s5 - 1; math.Abs(r.Multipliers[0]-want) > 1e-9 {
+		t.Errorf("LagrangeNewton multiplier got %v, want %v", r.Multipliers[0], want)
+	}
+	if _, ok := r.X["lambda1"]; ok {
+		t.Errorf("LagrangeNewton leaked the multiplier into X")
+	}
+
+	// the same problem with y called lambda1,
+	// which the multiplier has to steer clear of
+	l := Var{"lambda1"}
+	f = Add{Pow{Add{x, Num{-2.}}, 2.}, Pow{Add{l, Num{-1.}}, 2.}}
+	circle = Add{Pow{x, 2.}, Add{Pow{l, 2.}, Num{-1.}}}
+	r = LagrangeNewton(f, []Expression{circle}, []Var{x, l},
+		map[string]float64{"x": 1, "lambda1": 1}, 1e-12, 50)
+	if !r.Converged || math.Abs(r.X["x"]-2/s5) > 1e-9 || math.Abs(r.X["lambda1"]-1/s5) > 1e-9 || len(r.X) != 2 {
+		t.Errorf("LagrangeNewton with a variable lambda1 got %+v, want (%v, %v)", r, 2/s5, 1/s5)
+	}
+}
+
+func TestLagrangeSolve(t *testing.T) {
+	x, y, z := Var{"x"}, Var{"y"}, Var{"z"}
+	s5 := math.Sqrt(5)
+	table := []struct {
+		description string
+		f           Expression
+		cons        []Expression
+		vars        []Var
+		want        []map[string]float64
+	}{
+		{"closest point on a line",
+			Add{Pow{x, 2.}, Pow{y, 2.}},
+			[]Expression{Add{x, Add{y, Num{-2.}}}},
+			[]Var{x, y},
+			[]map[string]float64{{"x": 1, "y": 1, "lambda1": -2}},
+		},
+		{"closest and farthest points on a circle",
+			Add{Pow{Add{x, Num{-2.}}, 2.}, Pow{Add{y, Num{-1.}}, 2.}},
+			[]Expression{Add{Pow{x, 2.}, Add{Pow{y, 2.}, Num{-1.}}}},
+			[]Var{x, y},
+			[]map[string]float64{
+				{"x": 2 / s5, "y": 1 / s5, "lambda1": s5 - 1},
+				{"x": -2 / s5, "y": -1 / s5, "lambda1": -s5 - 1},
+			},
+		},
+		{"box of volume 8, least surface",
+			Add{Mul{x, y}, Add{Mul{y, z}, Mul{x, z}}},
+			[]Expression{Add{Mul{x, Mul{y, z}}, Num{-8.}}},
+			[]Var{x, y, z},
+			[]map[string]float64{{"x": 2, "y": 2, "z": 2, "lambda1": -1}},
+		},
+	}
+	for _, tt := range table {
+		s, err := LagrangeSolve(tt.f, tt.cons, tt.vars)
+		if err != nil {
+			t.Errorf("LagrangeSolve %v: %v", tt.description, err)
+			continue
+		}
+		if len(s) != len(tt.want) {
+			t.Errorf("LagrangeSolve %v got %v points, want %v: %v", tt.description, len(s), len(tt.want), s)
+			continue
+		}
+		for i, want := range tt.want {
+			for v, e := range s[i] {
+				if got := Eval(e, nil); math.Abs(got-want[v.Name]) > 1e-8 {
+					t.Errorf("LagrangeSolve %v point %v got %v = %v, want %v",
+						tt.description, i, v.Name, got, want[v.Name])
+				}
+			}
+		}
+	}
+
+	if _, err := LagrangeSolve(Sin{x}, []Expression{Add{x, y}}, []Var{x, y}); err == nil {
+		t.Errorf("LagrangeSolve of Sin(x) should fail")
+	}
+}
+
+func TestKKT(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	start := map[string]float64{"x": 0, "y": 0}
+	table := []struct {
+		description string
+		f           Expression
+		eqs, ineqs  []Expression
+		want        map[string]float64
+		multipliers []float64
+	}{
+		{"active half plane",
+			Add{Pow{Add{x, Num{-2.}}, 2.}, Pow{Add{y, Num{-2.}}, 2.}},
+			nil,
+			[]Expression{Add{x, Add{y, Num{-2.}}}, Add{x, Num{-3.}}},
+			map[string]float64{"x": 1, "y": 1},
+			[]float64{2, 0},
+		},
+		{"inactive half plane",
+			Add{Pow{x, 2.}, Pow{y, 2.}},
+			nil,
+			[]Expression{Add{x, Add{y, Num{-2.}}}},
+			map[string]float64{"x": 0, "y": 0},
+			[]float64{0},
+		},
+		{"equality and a corner",
+			Add{Pow{Add{x, Num{-3.}}, 2.}, Pow{y, 2.}},
+			[]Expression{Add{x, Mul{Num{-1.}, y}}},
+			[]Expression{Add{x, Num{-1.}}},
+			map[string]float64{"x": 1, "y": 1},
+			[]float64{2, 2},
+		},
+	}
+	for _, tt := range table {
+		r, err := KKT(tt.f, tt.eqs, tt.ineqs, []Var{x, y}, start, 1e-12, 50)
+		if err != nil {
+			t.Errorf("KKT %v: %v", tt.description, err)
+			continue
+		}
+		for name, want := range tt.want {
+			if math.Abs(r.X[name]-want) > 1e-9 {
+				t.Errorf("KKT %v got %v = %v, want %v", tt.description, name, r.X[name], want)
+			}
+		}
+		for i, want := range tt.multipliers {
+			if math.Abs(r.Multipliers[i]-want) > 1e-9 {
+				t.Errorf("KKT %v got multipliers %v, want %v", tt.description, r.Multipliers, tt.multipliers)
+				break
+			}
+		}
+	}
+
+	ineqs := make([]Expression, maxActiveSets+1)
+	for i := range ineqs {
+		ineqs[i] = Add{x, Num{float64(-i)}}
+	}
+	if r, err := KKT(Pow{x, 2.}, nil, ineqs, []Var{x, y}, start, 1e-12, 50); err == nil {
+		t.Errorf("KKT with %v inequalities should fail, got %+v", len(ineqs), r)
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"math"
 	"reflect"
-	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // An Expr is a struct which implements Derive
@@ -50,12 +51,44 @@ type Var struct {
 	Name string
 }
 
+// An UndefinedFunction is an unspecified
+// function of its arguments, like f(x, y)
+type UndefinedFunction struct {
+	Name string
+	Args []Expression
+}
+
+// A Derivative is left unevaluated: F
+// differentiated once with respect to
+// each of Wrt, e.g. f'(x)
+type Derivative struct {
+	F   Expression
+	Wrt []Var
+}
+
+// An At is F with each of Vars replaced by the matching
+// Vals, held off because F differentiates by them. f'(x^2)
+// is D(f(#1), #1) at #1 = x^2.
+type At struct {
+	F    Expression
+	Vars []Var
+	Vals []Expression
+}
+
 // package internal struct for
 // marking subtrees constant
 type con struct {
 	E1 Expression
 }
 
+// package internal struct for marking
+// a polynomial to be differentiated
+// with respect to V alone
+type polyWrt struct {
+	P Poly
+	V Var
+}
+
 // polynomial type
 type Poly struct {
 	//terms and coefficients map
@@ -98,6 +131,8 @@ func GenericParse(before replaceOrHalt, after replacer, e Expression) Expression
 		// don't do further processing
 		// just strip constant symbols
 		e = f(v.E1)
+	case polyWrt:
+		e = f(v.P)
 	case Cos:
 		e = Cos{f(v.E1)}
 	case Num:
@@ -116,6 +151,20 @@ func GenericParse(before replaceOrHalt, after replacer, e Expression) Expression
 		e = Mul{f(v.E1), f(v.E2)}
 	case Add:
 		e = Add{f(v.E1), f(v.E2)}
+	case UndefinedFunction:
+		args := make([]Expression, len(v.Args))
+		for i, a := range v.Args {
+			args[i] = f(a)
+		}
+		e = UndefinedFunction{v.Name, args}
+	case Derivative:
+		e = Derivative{f(v.F), v.Wrt}
+	case At:
+		vals := make([]Expression, len(v.Vals))
+		for i, a := range v.Vals {
+			vals[i] = f(a)
+		}
+		e = At{f(v.F), v.Vars, vals}
 	default:
 		panic("Tried to reach undefined type in tree")
 	}
@@ -149,6 +198,8 @@ func ForwardSub(e, replace Expression, find Var) Expression {
 		// don't do further processing
 		// just strip constant symbols
 		return f(v.E1)
+	case polyWrt:
+		return f(v.P)
 	case Cos:
 		return Cos{f(v.E1)}
 	case Num:
@@ -167,12 +218,101 @@ func ForwardSub(e, replace Expression, find Var) Expression {
 		return Mul{f(v.E1), f(v.E2)}
 	case Add:
 		return Add{f(v.E1), f(v.E2)}
+	case UndefinedFunction:
+		args := make([]Expression, len(v.Args))
+		for i, a := range v.Args {
+			args[i] = f(a)
+		}
+		return UndefinedFunction{v.Name, args}
+	case Derivative:
+		for _, w := range v.Wrt {
+			if w == find {
+				// f'(2) is f'(x) at x = 2
+				return At{v, []Var{find}, []Expression{replace}}
+			}
+		}
+		return Derivative{f(v.F), v.Wrt}
+	case At:
+		vals := make([]Expression, len(v.Vals))
+		for i, a := range v.Vals {
+			vals[i] = f(a)
+		}
+		for _, w := range v.Vars {
+			if w == find {
+				// bound inside F
+				return At{v.F, v.Vars, vals}
+			}
+		}
+		return At{f(v.F), v.Vars, vals}
 	default:
 		panic("fsub tried to reach undefined type in tree")
 	}
 
 }
 
+// Variables lists every Var occurring in e,
+// looking inside polynomials and their atoms,
+// sorted by name.
+func Variables(e Expression) []Var {
+	seen := make(map[Var]bool)
+	var walk func(e Expression)
+	before := func(e Expression) (Expression, bool) {
+		switch v := e.(type) {
+		case Var:
+			seen[v] = true
+		case Poly:
+			walk(v)
+		case Derivative:
+			for _, w := range v.Wrt {
+				seen[w] = true
+			}
+		case At:
+			// the bound variables aren't free
+			for _, w := range Variables(v.F) {
+				free := true
+				for _, u := range v.Vars {
+					free = free && u != w
+				}
+				seen[w] = seen[w] || free
+			}
+			for _, a := range v.Vals {
+				walk(a)
+			}
+			return e, false
+		}
+		return e, true
+	}
+	after := func(e Expression) Expression {
+		return e
+	}
+	walk = func(e Expression) {
+		p, ok := e.(Poly)
+		if !ok {
+			GenericParse(before, after, e)
+			return
+		}
+		for key := range p.terms {
+			monomials, _ := decomposePoly(key)
+			for _, m := range monomials {
+				if strings.HasPrefix(m, "[") {
+					walk(indeterminate(m))
+					continue
+				}
+				seen[Var{m}] = true
+			}
+		}
+	}
+	walk(e)
+	var vs []Var
+	for v := range seen {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i].Name < vs[j].Name
+	})
+	return vs
+}
+
 func Apply(f Function, e Expression) Expression {
 	if len(f.Vars) == 0 {
 		return f
@@ -180,29 +320,98 @@ func Apply(f Function, e Expression) Expression {
 	return Simplify(ForwardSub(f.E1, e, f.Vars[0]))
 }
 
+// decomposePoly splits a monomial key into its
+// indeterminates and their exponents. An indeterminate
+// is a single letter a-z or a bracketed atom like
+// "[Sin(x)]", e.g. "x[Sin(x)]^2y^-1".
 func decomposePoly(s string) ([]string, []int) {
+	monomials, exponents, err := decomposeKey(s)
+	if err != nil {
+		panic(err)
+	}
+	return monomials, exponents
+}
+
+// decomposeKey is decomposePoly for keys
+// that haven't been checked yet
+func decomposeKey(s string) ([]string, []int, error) {
 
 	var monomials []string
 	var exponents []int
 
-	re := regexp.MustCompile(`[a-z]\^[0-9\-]+`)
+	for i := 0; i < len(s); {
+		j := i + 1
+		if s[i] == '[' {
+			// atoms may hold brackets of their own
+			depth := 0
+			for j = i; j < len(s); j++ {
+				if s[j] == '[' {
+					depth++
+				}
+				if s[j] == ']' {
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			if depth != 0 {
+				return nil, nil, fmt.Errorf("unbalanced polynomial atom %v", s)
+			}
+			j++
+		} else {
+			_, n := utf8.DecodeRuneInString(s[i:])
+			j = i + n
+		}
+		monomials = append(monomials, s[i:j])
+
+		exp := 1
+		if j < len(s) && s[j] == '^' {
+			k := j + 1
+			if k < len(s) && s[k] == '-' {
+				k++
+			}
+			for k < len(s) && s[k] >= '0' && s[k] <= '9' {
+				k++
+			}
+			var err error
+			exp, err = strconv.Atoi(s[j+1 : k])
+			if err != nil {
+				return nil, nil, err
+			}
+			j = k
+		}
+		exponents = append(exponents, exp)
+		i = j
+	}
+	return monomials, exponents, nil
+}
 
-	// Pack monomials and exponents with the single cases
-	for _, r := range re.ReplaceAllString(s, "") {
-		monomials = append(monomials, string(r))
-		exponents = append(exponents, 1)
+// polyName is the name e goes by inside a monomial.
+// Variables named by a single letter a-z keep their
+// name, anything else, like Sin(x), Var{"theta"} or
+// Var{"θ"}, is bracketed.
+func polyName(e Expression) string {
+	e = simplify(e)
+	if v, ok := e.(Var); ok && len(v.Name) == 1 &&
+		v.Name[0] >= 'a' && v.Name[0] <= 'z' {
+		return v.Name
 	}
+	return "[" + atomKey(e) + "]"
+}
 
-	// Parse and pack the monomials with non-1 exponents
-	for _, str := range re.FindAllString(s, -1) {
-		monomials = append(monomials, string(str[0]))
-		i, err := strconv.Atoi(str[2:])
+// indeterminate is the expression a monomial name stands
+// for. Keys are checked when a polynomial is made, so
+// a name that doesn't read back is a bug.
+func indeterminate(name string) Expression {
+	if strings.HasPrefix(name, "[") {
+		e, err := parseAtom(name)
 		if err != nil {
 			panic(err)
 		}
-		exponents = append(exponents, i)
+		return e
 	}
-	return monomials, exponents
+	return Var{name}
 }
 
 func makePolyTerm(monomials []string, exponents []int) string {
@@ -227,6 +436,8 @@ func makePolyTerm(monomials []string, exponents []int) string {
 	for _, key := range sorted {
 		v := m[key]
 		switch v {
+		case 0:
+			// x^0 drops out
 		case 1:
 			ret += key
 		default:
@@ -251,6 +462,9 @@ func reduce(s string) string {
 func newPoly(m map[string]float64) Poly {
 	r := make(map[string]float64)
 	for key, value := range m {
+		if err := checkKey(key); err != nil {
+			panic(err)
+		}
 		key = reduce(key)
 		if _, ok := r[key]; ok {
 			panic("polynomial init error")
@@ -272,19 +486,31 @@ func isTypeEqualToFloat(a interface{}, b float64) bool {
 	return math.Abs(n.Val-b) < .0000000001
 }
 
+// cancels reports whether a and b sum to zero, up
+// to rounding. A small coefficient on its own can
+// still weigh a large monomial, so it has to stay.
+func cancels(a, b float64) bool {
+	return math.Abs(a+b) <= 1e-10*math.Max(math.Abs(a), math.Abs(b))
+}
+
 func mul(p1, p2 Poly) Poly {
 	r := make(map[string]float64)
 	for k1, v1 := range p1.terms {
 		for k2, v2 := range p2.terms {
+			if v1*v2 == 0 {
+				continue
+			}
 			key := reduce(k1 + k2)
-			if val, ok := r[key]; ok {
-				r[key] = val + v1*v2
-			} else {
+			val, ok := r[key]
+			if !ok {
 				r[key] = v1 * v2
+				continue
 			}
-			if v := r[key]; almostEqual(v, 0.) {
+			if cancels(val, v1*v2) {
 				delete(r, key)
+				continue
 			}
+			r[key] = val + v1*v2
 		}
 	}
 	return Poly{r}
@@ -292,25 +518,33 @@ func mul(p1, p2 Poly) Poly {
 
 // combine like terms
 func add(p1, p2 Poly) Poly {
+	r := make(map[string]float64)
+	for key, value := range p2.terms {
+		r[key] = value
+	}
 	for key, value := range p1.terms {
-		if _, ok := p2.terms[key]; ok {
+		if _, ok := r[key]; ok {
 			//there's a like term
-			p2.terms[key] = p2.terms[key] + value
-		} else {
-			p2.terms[key] = value
-		}
-		if v := p2.terms[key]; almostEqual(v, 0.) {
-			delete(p2.terms, key)
+			if cancels(r[key], value) {
+				delete(r, key)
+				continue
+			}
+			r[key] = r[key] + value
+		} else if value != 0 {
+			r[key] = value
 		}
 	}
-	return p2
+	return Poly{r}
 }
 
 // substitute subs all occurrences of
-// v Var in poly with e
+// v Var in poly with e, including those
+// inside atoms like Sin(v)
 func substitute(p Poly, v Var, e Expression) Expression {
 
 	var summands []Expression
+	untouched := make(map[string]float64)
+	name := polyName(v)
 	// Careful iteration isn't ordered
 	var keys []string
 	for term := range p.terms {
@@ -321,23 +555,44 @@ func substitute(p Poly, v Var, e Expression) Expression {
 	for _, term := range keys {
 		coef := p.terms[term]
 		monomials, exponents := decomposePoly(term)
+		var kept []string
+		var keptExp []int
+		var subbed []Expression
 		for i, s := range monomials {
-			if s == v.Name {
-				exp := exponents[i]
-				// Remove the monomial from the term
-				monomials = append(monomials[:i], monomials[i+1:]...)
-				exponents = append(exponents[:i], exponents[i+1:]...)
-				key := makePolyTerm(monomials, exponents)
-				p := newPoly(map[string]float64{key: coef})
-				//fmt.Printf("%v=\n", Read(e))
-				t := Mul{Pow{e, float64(exp)}, p}
-				summands = append(summands, t)
+			exp := float64(exponents[i])
+			switch {
+			case s == name:
+				subbed = append(subbed, Pow{e, exp})
+			case strings.HasPrefix(s, "["):
+				atom := indeterminate(s)
+				if r := ForwardSub(atom, e, v); !reflect.DeepEqual(r, atom) {
+					subbed = append(subbed, Pow{r, exp})
+					continue
+				}
+				fallthrough
+			default:
+				// Keep the monomial in the term
+				kept = append(kept, s)
+				keptExp = append(keptExp, exponents[i])
 			}
 		}
+		key := makePolyTerm(kept, keptExp)
+		if len(subbed) == 0 {
+			untouched[key] = coef
+			continue
+		}
+		var t Expression = newPoly(map[string]float64{key: coef})
+		for i := len(subbed) - 1; i >= 0; i-- {
+			t = Mul{subbed[i], t}
+		}
+		summands = append(summands, t)
 	}
 	if len(summands) == 0 {
 		return p
 	}
+	if len(untouched) > 0 {
+		summands = append([]Expression{newPoly(untouched)}, summands...)
+	}
 	if len(summands) == 1 {
 		return summands[0]
 	}
@@ -350,6 +605,101 @@ func substitute(p Poly, v Var, e Expression) Expression {
 	return ret
 }
 
+// polyDependsOn reports whether v occurs in p,
+// either bare or inside one of its atoms
+func polyDependsOn(p Poly, v Var) bool {
+	name := polyName(v)
+	for key := range p.terms {
+		monomials, _ := decomposePoly(key)
+		for _, m := range monomials {
+			if m == name {
+				return true
+			}
+			if !strings.HasPrefix(m, "[") {
+				continue
+			}
+			if _, ok := markTreesConstant(v, indeterminate(m)).(con); !ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// polyPartial differentiates p with respect
+// to one of its indeterminates
+func polyPartial(p Poly, name string) Poly {
+	r := make(map[string]float64)
+	for key, coef := range p.terms {
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			if m != name {
+				continue
+			}
+			c := coef * float64(exponents[i])
+			if c == 0 {
+				continue
+			}
+			exponents[i]--
+			key = makePolyTerm(monomials, exponents)
+			if old, ok := r[key]; ok && cancels(old, c) {
+				delete(r, key)
+				continue
+			}
+			r[key] += c
+		}
+	}
+	return Poly{r}
+}
+
+// derivePoly applies the chain rule over the
+// indeterminates of p, d giving the derivative
+// of each one.
+func derivePoly(p Poly, d func(Expression) Expression) Expression {
+	names := make(map[string]bool)
+	for key := range p.terms {
+		monomials, _ := decomposePoly(key)
+		for _, m := range monomials {
+			names[m] = true
+		}
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var summands []Expression
+	for _, name := range sorted {
+		dn := d(indeterminate(name))
+		if isTypeEqualToFloat(dn, 0.) {
+			continue
+		}
+		dp := polyPartial(p, name)
+		if isTypeEqualToFloat(dn, 1.) {
+			summands = append(summands, dp)
+			continue
+		}
+		summands = append(summands, Mul{dp, dn})
+	}
+	if len(summands) == 0 {
+		return Num{0.}
+	}
+	z := summands[len(summands)-1]
+	for i := len(summands) - 2; i >= 0; i-- {
+		z = Add{summands[i], z}
+	}
+	return z
+}
+
+// DerivePoly differentiates p with respect to v,
+// termwise. Atoms depending on v, like Sin(v),
+// contribute through the chain rule and their
+// derivatives join the polynomial as atoms.
+func DerivePoly(p Poly, v Var) Poly {
+	return asPoly(makePoly(Simplify(PartialDerive(v, p))))
+}
+
 // Converts expression to a string
 func Read(e Expression) string {
 	e = Simplify(e)
@@ -378,6 +728,24 @@ func Read(e Expression) string {
 		return fmt.Sprintf("CONST(%v)", Read(v.E1))
 	case Poly:
 		return fmt.Sprintf("P{%v}", v.terms)
+	case UndefinedFunction:
+		var args []string
+		for _, a := range v.Args {
+			args = append(args, Read(a))
+		}
+		return fmt.Sprintf("%v(%v)", v.Name, strings.Join(args, ", "))
+	case Derivative:
+		s := Read(v.F)
+		for _, w := range v.Wrt {
+			s += ", " + w.Name
+		}
+		return fmt.Sprintf("D(%v)", s)
+	case At:
+		s := Read(v.F)
+		for i, w := range v.Vars {
+			s += fmt.Sprintf(", %v=%v", w.Name, Read(v.Vals[i]))
+		}
+		return fmt.Sprintf("At(%v)", s)
 	}
 	return ""
 }
@@ -387,36 +755,90 @@ func Simplify(e Expression) Expression {
 	return simplify(e)
 }
 
-// makePoly attempts to rearrange expression terms as polynomials
-func makePoly(e Expression) Expression {
-	tryPoly := func(e Expression) (Expression, bool) {
-		switch v := e.(type) {
-		case Poly:
-			return e, true
-		case Var:
-			return newPoly(map[string]float64{v.Name: 1.}), true
-		case Num:
-			return newPoly(map[string]float64{"": v.Val}), true
+// asPoly views e as a polynomial. Integer powers are
+// multiplied out and any other subtree that isn't
+// already polynomial, like Sin(x), becomes an opaque
+// indeterminate.
+func asPoly(e Expression) Poly {
+	switch v := e.(type) {
+	case Poly:
+		return v
+	case Var:
+		return newPoly(map[string]float64{polyName(v): 1.})
+	case Num:
+		return newPoly(map[string]float64{"": v.Val})
+	case Pow:
+		if !isInteger(v.Exponent) || math.Abs(v.Exponent) > math.MaxInt32 {
+			break
+		}
+		n := int(v.Exponent)
+		base := asPoly(v.Base)
+		if n == 0 {
+			return newPoly(map[string]float64{"": 1.})
+		}
+		if len(base.terms) == 1 {
+			// a monomial scales its exponents
+			for key, coef := range base.terms {
+				monomials, exponents := decomposePoly(key)
+				for i := range exponents {
+					exponents[i] *= n
+				}
+				r := make(map[string]float64)
+				if c := math.Pow(coef, float64(n)); c != 0 {
+					r[makePolyTerm(monomials, exponents)] = c
+				}
+				return Poly{r}
+			}
+		}
+		if n < 0 || expansion(len(base.terms), n) > maxExpansion {
+			key := makePolyTerm([]string{polyName(v.Base)}, []int{n})
+			return newPoly(map[string]float64{key: 1.})
+		}
+		// square and multiply
+		r := newPoly(map[string]float64{"": 1.})
+		for ; n > 0; n >>= 1 {
+			if n&1 == 1 {
+				r = mul(r, base)
+			}
+			if n > 1 {
+				base = mul(base, base)
+			}
 		}
-		return e, false
+		return r
+	}
+	return newPoly(map[string]float64{polyName(e): 1.})
+}
+
+// maxExpansion caps the terms an integer power of
+// a polynomial is multiplied out to. Bigger powers
+// stay opaque, like negative ones.
+const maxExpansion = 10000
+
+// expansion bounds the terms of a k term
+// polynomial to the nth, C(n+k-1, k-1),
+// stopping once past maxExpansion
+func expansion(k, n int) int {
+	if n > maxExpansion {
+		return n
+	}
+	c := 1
+	for i := 1; i < k && c <= maxExpansion; i++ {
+		c = c * (n + i) / i
 	}
+	return c
+}
+
+// makePoly attempts to rearrange expression terms as polynomials
+func makePoly(e Expression) Expression {
 	before := func(ex Expression) (Expression, bool) {
 		return ex, true
 	}
 	after := func(e Expression) Expression {
 		switch v := e.(type) {
 		case Mul:
-			a, ok1 := tryPoly(v.E1)
-			b, ok2 := tryPoly(v.E2)
-			if ok1 && ok2 {
-				return mul(a.(Poly), b.(Poly))
-			}
+			return mul(asPoly(v.E1), asPoly(v.E2))
 		case Add:
-			a, ok1 := tryPoly(v.E1)
-			b, ok2 := tryPoly(v.E2)
-			if ok1 && ok2 {
-				return add(a.(Poly), b.(Poly))
-			}
+			return add(asPoly(v.E1), asPoly(v.E2))
 		}
 		return e
 	}
@@ -435,6 +857,30 @@ func simplify(e Expression) Expression {
 		// don't do further processing
 		// just strip constant symbols
 		return simplify(v.E1)
+	case polyWrt:
+		return v.P
+	case UndefinedFunction:
+		args := make([]Expression, len(v.Args))
+		for i, a := range v.Args {
+			args[i] = simplify(a)
+		}
+		return UndefinedFunction{v.Name, args}
+	case Derivative:
+		return Derivative{simplify(v.F), v.Wrt}
+	case At:
+		f := simplify(v.F)
+		vals := make([]Expression, len(v.Vals))
+		for i, a := range v.Vals {
+			vals[i] = simplify(a)
+		}
+		if differentiates(f, v.Vars) {
+			return At{f, v.Vars, vals}
+		}
+		// nothing holds the substitution off anymore
+		for i, w := range v.Vars {
+			f = ForwardSub(f, vals[i], w)
+		}
+		return simplify(f)
 	case Cos:
 		return Cos{simplify(v.E1)}
 	case Sin:
@@ -621,6 +1067,22 @@ func markTreesConstant(va Var, e Expression) Expression {
 			}
 		case con:
 			return v, false
+		case Poly:
+			if polyDependsOn(v, va) {
+				return polyWrt{v, va}, false
+			}
+			return con{v}, false
+		case Derivative:
+			if _, ok := v.F.(UndefinedFunction); !ok {
+				return markTreesConstant(va, evaluateDerivative(v)), false
+			}
+		case At:
+			for _, w := range Variables(v) {
+				if w == va {
+					return e, true
+				}
+			}
+			return con{v}, false
 		}
 		return e, true
 	}
@@ -655,6 +1117,17 @@ func markTreesConstant(va Var, e Expression) Expression {
 			if checkCon(v.E1) && checkCon(v.E2) {
 				return con{e}
 			}
+		case UndefinedFunction:
+			for _, a := range v.Args {
+				if !checkCon(a) {
+					return e
+				}
+			}
+			return con{e}
+		case Derivative:
+			if checkCon(v.F) {
+				return con{e}
+			}
 		}
 		return e
 	}
@@ -699,6 +1172,12 @@ func Derive(e Expression) Expression {
 	switch v := e.(type) {
 	case con:
 		return derive(v)
+	case Poly:
+		return derivePoly(v, Derive)
+	case polyWrt:
+		return derivePoly(v.P, func(e Expression) Expression {
+			return PartialDerive(v.V, e)
+		})
 	case Num:
 		return derive(v)
 	case Var:
@@ -732,6 +1211,121 @@ func Derive(e Expression) Expression {
 			Derive(v.E1),
 			Derive(v.E2),
 		}
+	case UndefinedFunction:
+		return deriveUndefined(v, nil)
+	case Derivative:
+		if f, ok := v.F.(UndefinedFunction); ok {
+			return deriveUndefined(f, v.Wrt)
+		}
+		return Derive(evaluateDerivative(v))
+	case At:
+		return deriveAt(v)
 	}
 	return e
 }
+
+// differentiates reports whether some Derivative
+// in e is taken with respect to one of vars
+func differentiates(e Expression, vars []Var) bool {
+	found := false
+	before := func(e Expression) (Expression, bool) {
+		if d, ok := e.(Derivative); ok {
+			for _, w := range d.Wrt {
+				for _, v := range vars {
+					if w == v {
+						found = true
+					}
+				}
+			}
+		}
+		return e, !found
+	}
+	after := func(e Expression) Expression {
+		return e
+	}
+	GenericParse(before, after, e)
+	return found
+}
+
+// deriveAt is the chain rule through a substitution:
+// F's own dependence with its bound variables held
+// fixed, plus the sum over them of dF/dv at Vals
+// times Derive(val).
+func deriveAt(a At) Expression {
+	bound := func(e Expression) (Expression, bool) {
+		switch v := e.(type) {
+		case con:
+			return v, false
+		case Var:
+			for _, w := range a.Vars {
+				if v == w {
+					return con{v}, false
+				}
+			}
+		}
+		return e, true
+	}
+	keep := func(e Expression) Expression {
+		return e
+	}
+	var z Expression = At{Derive(GenericParse(bound, keep, a.F)), a.Vars, a.Vals}
+	// con marks, from a partial derivative,
+	// mustn't hide F from its bound variables
+	f := simplify(a.F)
+	for i, w := range a.Vars {
+		z = Add{z, Mul{At{PartialDerive(w, f), a.Vars, a.Vals}, Derive(a.Vals[i])}}
+	}
+	return z
+}
+
+// evaluateDerivative carries out the pending
+// derivatives of a known function
+func evaluateDerivative(d Derivative) Expression {
+	f := simplify(d.F)
+	for _, w := range d.Wrt {
+		// drop the con marks before the next pass
+		f = simplify(PartialDerive(w, f))
+	}
+	return f
+}
+
+// deriveUndefined is the chain rule into f(a1, a2...)
+// already differentiated by wrt: the sum over arguments
+// of D(f, wrt..., ai) * Derive(ai). Arguments marked
+// constant drop out. Any other argument than a variable
+// stands in for a slot variable #i, the derivative by
+// which is taken At #i = ai.
+func deriveUndefined(f UndefinedFunction, wrt []Var) Expression {
+	bare := simplify(f).(UndefinedFunction)
+	var summands []Expression
+	for i, a := range f.Args {
+		if _, ok := a.(con); ok {
+			continue
+		}
+		g := bare
+		v, ok := a.(Var)
+		if !ok {
+			v = Var{fmt.Sprintf("#%v", i+1)}
+			g.Args = append([]Expression{}, bare.Args...)
+			g.Args[i] = v
+		}
+		vs := append(append([]Var{}, wrt...), v)
+		// derivatives commute, keep them sorted
+		sort.Slice(vs, func(i, j int) bool {
+			return vs[i].Name < vs[j].Name
+		})
+		var d Expression = Derivative{g, vs}
+		if !ok {
+			d = At{d, []Var{v}, []Expression{bare.Args[i]}}
+		}
+		summands = append(summands, Mul{d, Derive(a)})
+	}
+	if len(summands) == 0 {
+		return Num{0.}
+	}
+	z := summands[len(summands)-1]
+	for i := len(summands) - 2; i >= 0; i-- {
+		z = Add{summands[i], z}
+	}
+	return z
+}
@@ -2,6 +2,8 @@ package lildiffer
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
 	"testing"
 )
@@ -27,14 +29,19 @@ func TestCyclesBehavior(t *testing.T) {
 	}
 }
 
-// Test Derive
-func TestDerive(t *testing.T) {
+// The tables of TestDerive, TestPartialDerive,
+// TestSimplify, TestPolyAdd and TestPolyMul also
+// seed the fuzz targets.
+
+type deriveCase struct {
+	description string
+	function    Expression
+	derivative  Expression
+}
+
+func deriveTable() []deriveCase {
 	type ptype map[string]float64
-	table := []struct {
-		description string
-		function    Expression
-		derivative  Expression
-	}{
+	return []deriveCase{
 		{"sin(6 * sin(x))",
 			Sin{Mul{Num{6.0}, Sin{Var{"x"}}}},
 			Mul{
@@ -59,23 +66,30 @@ func TestDerive(t *testing.T) {
 				newPoly(ptype{"": 4., "z^2": 1, "z": -4.})},
 		},
 	}
-	for _, tt := range table {
+}
+
+// Test Derive
+func TestDerive(t *testing.T) {
+	for _, tt := range deriveTable() {
 		raw := Derive(tt.function)
 		d := makePoly(Simplify(raw)) // test it simplified
-		if !reflect.DeepEqual(d, tt.derivative) {
+		// compare polynomial forms, atoms like Sin(x) included
+		if !reflect.DeepEqual(d, makePoly(tt.derivative)) {
 			fmt.Printf("TestDerive Error. Raw:\n %v\n Got:\n %v, want:\n %v \n", Read(raw), Read(d), Read(tt.derivative))
 		}
 	}
 }
 
-func TestPartialDerive(t *testing.T) {
+type partialDeriveCase struct {
+	description string
+	variable    Var
+	function    Expression
+	derivative  Expression
+}
+
+func partialDeriveTable() []partialDeriveCase {
 	type ptype map[string]float64
-	table := []struct {
-		description string
-		variable    Var
-		function    Expression
-		derivative  Expression
-	}{
+	return []partialDeriveCase{
 		{"a * sin(5+b))",
 			Var{"a"},
 			Mul{Var{"a"}, Sin{Add{Num{5.}, Var{"b"}}}},
@@ -115,12 +129,14 @@ func TestPartialDerive(t *testing.T) {
 			},
 		},
 	}
+}
 
-	for _, tt := range table {
+func TestPartialDerive(t *testing.T) {
+	for _, tt := range partialDeriveTable() {
 		raw := PartialDerive(tt.variable, tt.function)
 		d := makePoly(Simplify(raw))
 
-		if !reflect.DeepEqual(d, tt.derivative) {
+		if !reflect.DeepEqual(d, makePoly(tt.derivative)) {
 			x := fmt.Sprintf("\nPartialDerive Error\n %v wrt %v\n", tt.description, tt.variable)
 			y := fmt.Sprintf("\nPresimplified output: %v\n",
 				Read(raw))
@@ -134,13 +150,15 @@ func TestPartialDerive(t *testing.T) {
 	}
 }
 
-func TestSimplify(t *testing.T) {
+type simplifyCase struct {
+	description string
+	f           Expression
+	simplified  Expression
+}
+
+func simplifyTable() []simplifyCase {
 	type ptype map[string]float64
-	table := []struct {
-		description string
-		f           Expression
-		simplified  Expression
-	}{
+	return []simplifyCase{
 		{"5*((3*z)*(y*-1))",
 			Mul{Num{5.}, Mul{Mul{Num{3.}, Var{"z"}}, Mul{Var{"y"}, Num{-1.}}}},
 			newPoly(ptype{"yz": -15}),
@@ -179,8 +197,10 @@ func TestSimplify(t *testing.T) {
 			Cos{Var{"x"}},
 		},
 	}
+}
 
-	for _, tt := range table {
+func TestSimplify(t *testing.T) {
+	for _, tt := range simplifyTable() {
 		if got := makePoly(Simplify(tt.f)); !reflect.DeepEqual(got, tt.simplified) {
 			t.Errorf("\nSimplify Error %v\n", tt.description)
 			t.Errorf("got  %v\nwant %v\n",
@@ -195,12 +215,14 @@ func TestSimplify(t *testing.T) {
 * Polynomial TESTS
  */
 
-func TestPolyAdd(t *testing.T) {
+type polySumCase struct {
+	p1, p2 map[string]float64
+	sum    map[string]float64
+}
+
+func polyAddTable() []polySumCase {
 	type ptype map[string]float64
-	table := []struct {
-		p1, p2 map[string]float64
-		sum    map[string]float64
-	}{
+	return []polySumCase{
 		{
 			ptype{"": 4., "x^2y^5": 3.5, "x": 2.},
 			ptype{"x": 1.},
@@ -223,8 +245,10 @@ func TestPolyAdd(t *testing.T) {
 			ptype{"x": 2},
 		},
 	}
+}
 
-	for _, tt := range table {
+func TestPolyAdd(t *testing.T) {
+	for _, tt := range polyAddTable() {
 		got := add(newPoly(tt.p1), newPoly(tt.p2))
 		want := newPoly(tt.sum)
 		if !reflect.DeepEqual(got, want) {
@@ -236,12 +260,14 @@ func TestPolyAdd(t *testing.T) {
 	}
 }
 
-func TestPolyMul(t *testing.T) {
+type polyProductCase struct {
+	p1, p2  map[string]float64
+	product map[string]float64
+}
+
+func polyMulTable() []polyProductCase {
 	type ptype map[string]float64
-	table := []struct {
-		p1, p2  map[string]float64
-		product map[string]float64
-	}{
+	return []polyProductCase{
 		{
 			ptype{"": 4., "x^2y^5": 3.5, "x": 2.},
 			ptype{"x": 1.},
@@ -262,9 +288,17 @@ func TestPolyMul(t *testing.T) {
 			ptype{"": -1, "x": 1, "y": -1},
 			ptype{"": -1, "x^2": 1, "y^2": -1, "y": -2.},
 		},
+		// small coefficients aren't cancellation
+		{
+			ptype{"x^-40": 1e-12},
+			ptype{"x^-40": 1e-3},
+			ptype{"x^-80": 1e-15},
+		},
 	}
+}
 
-	for _, tt := range table {
+func TestPolyMul(t *testing.T) {
+	for _, tt := range polyMulTable() {
 		got := mul(newPoly(tt.p1), newPoly(tt.p2))
 		want := newPoly(tt.product)
 		if !reflect.DeepEqual(got, want) {
@@ -297,3 +331,291 @@ func TestFunctionsOne(t *testing.T) {
 	}
 
 }
+
+func TestPolyAtoms(t *testing.T) {
+	type ptype map[string]float64
+	x := Var{"x"}
+	sinx := polyName(Sin{x})
+	table := []struct {
+		description string
+		f           Expression
+		poly        Expression
+	}{
+		{"Sin(x)*Sin(x) + 2*Sin(x)",
+			Add{Mul{Sin{x}, Sin{x}}, Mul{Num{2.}, Sin{x}}},
+			newPoly(ptype{sinx + "^2": 1, sinx: 2}),
+		},
+		{"Cos(y)^2 * x + theta * x",
+			Add{Mul{Pow{Cos{Var{"y"}}, 2.}, x}, Mul{Var{"theta"}, x}},
+			newPoly(ptype{polyName(Cos{Var{"y"}}) + "^2x": 1, "[theta]x": 1}),
+		},
+		{"(x+1)^2 * x^-1",
+			Mul{Pow{Add{x, Num{1.}}, 2.}, Pow{x, -1.}},
+			newPoly(ptype{"x": 1, "": 2, "x^-1": 1}),
+		},
+		{"2 * (x+1)^-1",
+			Mul{Num{2.}, Pow{Add{x, Num{1.}}, -1.}},
+			newPoly(ptype{"[P{map[:1 x:1]}]^-1": 2}),
+		},
+		{"x^1000000 * x",
+			Mul{Pow{x, 1e6}, x},
+			newPoly(ptype{"x^1000001": 1}),
+		},
+		{"(2xy)^-3",
+			Mul{Pow{Mul{Num{2.}, Mul{x, Var{"y"}}}, -3.}, Num{1.}},
+			newPoly(ptype{"x^-3y^-3": 0.125}),
+		},
+		{"(x+1)^5",
+			Mul{Pow{Add{x, Num{1.}}, 5.}, Num{1.}},
+			newPoly(ptype{"x^5": 1, "x^4": 5, "x^3": 10, "x^2": 10, "x": 5, "": 1}),
+		},
+		{"(x+1)^100000 stays whole",
+			Mul{Pow{Add{x, Num{1.}}, 1e5}, Num{1.}},
+			newPoly(ptype{"[P{map[:1 x:1]}]^100000": 1}),
+		},
+	}
+	for _, tt := range table {
+		if got := makePoly(tt.f); !reflect.DeepEqual(got, tt.poly) {
+			t.Errorf("makePoly %v\ngot  %v\nwant %v", tt.description, got, tt.poly)
+		}
+	}
+
+	monomials, exponents := decomposePoly("x[Sin(P{map[:5 y:1]})]^2y^-1")
+	if !reflect.DeepEqual(monomials, []string{"x", "[Sin(P{map[:5 y:1]})]", "y"}) ||
+		!reflect.DeepEqual(exponents, []int{1, 2, -1}) {
+		t.Errorf("decomposePoly got %v %v", monomials, exponents)
+	}
+	if got := indeterminate(sinx); !reflect.DeepEqual(got, Sin{x}) {
+		t.Errorf("indeterminate(%v) = %v", sinx, got)
+	}
+
+	// atom names read back without having been seen
+	for _, e := range []Expression{
+		Var{"theta"},
+		Var{"Sin"},
+		Var{"x[1]"},
+		Var{`a"b\\c`},
+		Pow{Add{x, Num{-1.5e-7}}, -3},
+		Div{Cos{con{x}}, Num{math.Inf(1)}},
+		newPoly(ptype{"x[Sin(y)]^2": 1, "": -2}),
+		UndefinedFunction{"P", []Expression{x, Var{"y z"}}},
+		Derivative{UndefinedFunction{"f", []Expression{x}}, []Var{x}},
+		At{UndefinedFunction{"f", []Expression{Var{"#1"}}}, []Var{{"#1"}}, []Expression{Pow{x, 2}}},
+	} {
+		name := "[" + atomKey(e) + "]"
+		if got, err := parseAtom(name); err != nil || !reflect.DeepEqual(got, e) {
+			t.Errorf("parseAtom(%v) = %v, %v, want %#v", name, got, err, e)
+		}
+	}
+	for _, name := range []string{"[]", "[Sin(x]", "[(x%y)]", "[x y]", "[P{map[x:]}]", `["x]`, `["x\"]`} {
+		if _, err := parseAtom(name); err == nil {
+			t.Errorf("parseAtom(%v) should fail", name)
+		}
+	}
+	if _, err := NewRatPoly(map[string]*big.Rat{"x[Sin(x)": big.NewRat(1, 1)}); err == nil {
+		t.Errorf("NewRatPoly should reject unbalanced atoms")
+	}
+	if _, err := NewRatPoly(map[string]*big.Rat{"xy": big.NewRat(1, 1), "yx": big.NewRat(2, 1)}); err == nil {
+		t.Errorf("NewRatPoly should reject repeated monomials")
+	}
+	// bare names are only the ones polyName gives
+	for _, key := range []string{"θ", "X", "xθ^2", "[θ]x"} {
+		_, err := NewRatPoly(map[string]*big.Rat{key: big.NewRat(1, 1)})
+		if want := key[0] == '['; (err == nil) != want {
+			t.Errorf("NewRatPoly %q got %v", key, err)
+		}
+	}
+	if got := polyName(Var{"θ"}); got != "[θ]" {
+		t.Errorf("polyName θ got %v, want [θ]", got)
+	}
+
+	// x Sin(x) + 3 with x -> 2 reaches inside the atom
+	p := newPoly(ptype{"x" + sinx: 1, "": 3})
+	got := ForwardSub(p, Num{2.}, x)
+	want := Add{newPoly(ptype{"": 3}),
+		Mul{Pow{Sin{Num{2.}}, 1.}, Mul{Pow{Num{2.}, 1.}, newPoly(ptype{"": 1})}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ForwardSub into atoms got %v, want %v", Read(got), Read(want))
+	}
+}
+
+func TestDerivePoly(t *testing.T) {
+	type ptype map[string]float64
+	x, y := Var{"x"}, Var{"y"}
+	sinx, cosx := polyName(Sin{x}), polyName(Cos{x})
+	table := []struct {
+		description string
+		p           Poly
+		variable    Var
+		derivative  Poly
+	}{
+		{"x^3y^2 + 2x - y^-1 wrt x",
+			newPoly(ptype{"x^3y^2": 1, "x": 2, "y^-1": -1}),
+			x,
+			newPoly(ptype{"x^2y^2": 3, "": 2}),
+		},
+		{"x^3y^2 + 2x - y^-1 wrt y",
+			newPoly(ptype{"x^3y^2": 1, "x": 2, "y^-1": -1}),
+			y,
+			newPoly(ptype{"x^3y": 2, "y^-2": 1}),
+		},
+		{"5 wrt x",
+			newPoly(ptype{"": 5}),
+			x,
+			newPoly(ptype{"": 0}),
+		},
+		{"y Sin(x)^2 wrt x",
+			newPoly(ptype{"y" + sinx + "^2": 1}),
+			x,
+			newPoly(ptype{cosx + sinx + "y": 2}),
+		},
+		{"small coefficient 1e-12x^2 - y wrt x",
+			newPoly(ptype{"x^2": 1e-12, "y": -1}),
+			x,
+			newPoly(ptype{"x": 2e-12}),
+		},
+	}
+	for _, tt := range table {
+		if got := DerivePoly(tt.p, tt.variable); !reflect.DeepEqual(got, tt.derivative) {
+			t.Errorf("DerivePoly %v\ngot  %v\nwant %v", tt.description, got, tt.derivative)
+		}
+	}
+}
+
+// Differentiating the polynomial form must agree
+// with differentiating the tree and then simplifying.
+func TestDerivePolyForm(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	table := []struct {
+		description string
+		function    Expression
+	}{
+		{"x^4 + 3x^9",
+			Add{Pow{x, 4.}, Mul{Num{3.}, Pow{x, 9.}}}},
+		{"(3x+9)(2-x)",
+			Mul{Add{Mul{Num{3.0}, x}, Num{9.}}, Add{Num{2.}, Mul{Num{-1.}, x}}}},
+		{"x*y + y^2",
+			Add{Mul{x, y}, Pow{y, 2.}}},
+		{"sin(x) * (x + sin(x))",
+			Mul{Sin{x}, Add{x, Sin{x}}}},
+		{"5*cos(y*x)^3",
+			Mul{Num{5.0}, Pow{Cos{Mul{x, y}}, 3.}}},
+		{"sin(6 * sin(x))",
+			Sin{Mul{Num{6.0}, Sin{x}}}},
+	}
+	env := map[string]float64{"x": .7, "y": -1.3}
+	for _, tt := range table {
+		fromTree := makePoly(Simplify(Derive(tt.function)))
+		fromPoly := makePoly(Simplify(Derive(makePoly(Simplify(tt.function)))))
+		if !almostEqual(Eval(fromTree, env), Eval(fromPoly, env)) {
+			t.Errorf("Derive %v\nfrom tree %v\nfrom poly %v",
+				tt.description, Read(fromTree), Read(fromPoly))
+		}
+		for _, v := range []Var{x, y} {
+			fromTree = makePoly(Simplify(PartialDerive(v, tt.function)))
+			fromPoly = makePoly(Simplify(PartialDerive(v, makePoly(Simplify(tt.function)))))
+			if !almostEqual(Eval(fromTree, env), Eval(fromPoly, env)) {
+				t.Errorf("PartialDerive %v wrt %v\nfrom tree %v\nfrom poly %v",
+					tt.description, v, Read(fromTree), Read(fromPoly))
+			}
+		}
+	}
+}
+
+func TestUndefinedFunction(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	fx := UndefinedFunction{"f", []Expression{x}}
+	fxy := UndefinedFunction{"f", []Expression{x, y}}
+	// arguments other than variables go through slot #1
+	slot := Var{"#1"}
+	f1 := UndefinedFunction{"f", []Expression{slot}}
+	fx2 := UndefinedFunction{"f", []Expression{Pow{x, 2.}}}
+	df := At{Derivative{f1, []Var{slot}}, []Var{slot}, []Expression{Pow{x, 2.}}}
+	ddf := At{Derivative{f1, []Var{slot, slot}}, []Var{slot}, []Expression{Pow{x, 2.}}}
+	gx := UndefinedFunction{"g", []Expression{x}}
+	table := []struct {
+		description string
+		variable    Var
+		function    Expression
+		derivative  Expression
+	}{
+		{"f(x)^2 wrt x",
+			x,
+			Pow{fx, 2.},
+			Mul{Num{2.}, Mul{fx, Derivative{fx, []Var{x}}}},
+		},
+		{"f(x, y) wrt x",
+			x,
+			fxy,
+			Derivative{fxy, []Var{x}},
+		},
+		{"f(x) wrt y",
+			y,
+			Mul{fx, y},
+			fx,
+		},
+		{"D(f(x, y), y) wrt x is D(f(x, y), x, y)",
+			x,
+			Derivative{fxy, []Var{y}},
+			Derivative{fxy, []Var{x, y}},
+		},
+		{"sin(g(x))",
+			x,
+			Sin{UndefinedFunction{"g", []Expression{x}}},
+			Mul{Cos{UndefinedFunction{"g", []Expression{x}}},
+				Derivative{UndefinedFunction{"g", []Expression{x}}, []Var{x}}},
+		},
+		{"D(x^2 y^2, y) wrt x carries out the known derivative",
+			x,
+			Derivative{Mul{Pow{x, 2.}, Pow{y, 2.}}, []Var{y}},
+			Mul{Num{4.}, Mul{x, y}},
+		},
+		{"f(x^2) wrt x",
+			x,
+			fx2,
+			Mul{df, Mul{Num{2.}, x}},
+		},
+		{"D(f(x^2)) wrt x",
+			x,
+			Mul{df, Mul{Num{2.}, x}},
+			Add{Mul{ddf, Mul{Num{4.}, Pow{x, 2.}}}, Mul{Num{2.}, df}},
+		},
+		{"f(x^2) wrt y",
+			y,
+			Mul{fx2, y},
+			fx2,
+		},
+		{"f(g(x))",
+			x,
+			UndefinedFunction{"f", []Expression{gx}},
+			Mul{At{Derivative{f1, []Var{slot}}, []Var{slot}, []Expression{gx}},
+				Derivative{gx, []Var{x}}},
+		},
+	}
+	for _, tt := range table {
+		d := makePoly(Simplify(PartialDerive(tt.variable, tt.function)))
+		if !reflect.DeepEqual(d, makePoly(tt.derivative)) {
+			t.Errorf("PartialDerive %v\ngot  %v\nwant %v",
+				tt.description, Read(d), Read(tt.derivative))
+		}
+	}
+
+	if got := Read(Derivative{fxy, []Var{x, y}}); got != "D(f(x, y), x, y)" {
+		t.Errorf("Read got %v", got)
+	}
+	// substituting for the variable of a derivative
+	// holds it off until after differentiating
+	at := ForwardSub(Derivative{fx, []Var{x}}, Num{2.}, x)
+	if got := Read(at); got != "At(D(f(x), x), x=2)" {
+		t.Errorf("ForwardSub into D(f(x), x) got %v", got)
+	}
+	if got := Eval(At{Derivative{Pow{x, 3.}, []Var{x}}, []Var{x}, []Expression{Num{2.}}}, nil); got != 12 {
+		t.Errorf("Eval of D(x^3, x) at x=2 got %v, want 12", got)
+	}
+	// mixed partials meet in the same node
+	dxy := PartialDerive(y, Simplify(PartialDerive(x, fxy)))
+	dyx := PartialDerive(x, Simplify(PartialDerive(y, fxy)))
+	if Read(dxy) != Read(dyx) {
+		t.Errorf("mixed partials differ: %v vs %v", Read(dxy), Read(dyx))
+	}
+}
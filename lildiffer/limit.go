@@ -0,0 +1,287 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Direction picks the side a Limit approaches from.
+type Direction int
+
+const (
+	BothSides Direction = iota
+	FromBelow
+	FromAbove
+)
+
+// terms of the Taylor series compared
+// before falling back on L'Hopital
+const seriesOrder = 8
+
+// L'Hopital steps before giving up
+const maxLHopital = 10
+
+// fraction rewrites e as a single quotient n/d
+// with no division left inside n or d, outside
+// of the arguments of Sin and Cos.
+func fraction(e Expression) (Expression, Expression) {
+	one := Num{1.}
+	switch v := e.(type) {
+	case Div:
+		n1, d1 := fraction(v.E1)
+		n2, d2 := fraction(v.E2)
+		return Mul{n1, d2}, Mul{d1, n2}
+	case Mul:
+		n1, d1 := fraction(v.E1)
+		n2, d2 := fraction(v.E2)
+		return Mul{n1, n2}, Mul{d1, d2}
+	case Add:
+		n1, d1 := fraction(v.E1)
+		n2, d2 := fraction(v.E2)
+		return Add{Mul{n1, d2}, Mul{n2, d1}}, Mul{d1, d2}
+	case Pow:
+		n, d := fraction(v.Base)
+		if v.Exponent < 0 {
+			n, d = d, n
+		}
+		p := math.Abs(v.Exponent)
+		return Pow{n, p}, Pow{d, p}
+	case Poly:
+		if !hasQuotient(v) {
+			return v, one
+		}
+		var z Expression = Num{0.}
+		for _, key := range sortedKeys(v.terms) {
+			var t Expression = Num{v.terms[key]}
+			monomials, exponents := decomposePoly(key)
+			for i, m := range monomials {
+				t = Mul{t, Pow{indeterminate(m), float64(exponents[i])}}
+			}
+			z = Add{z, t}
+		}
+		if _, ok := z.(Num); ok {
+			return z, one
+		}
+		return fraction(z)
+	case con:
+		return fraction(v.E1)
+	case polyWrt:
+		return fraction(v.P)
+	}
+	return e, one
+}
+
+// Limit finds the limit of e as v approaches point from
+// the given direction. e may only depend on v; point may
+// be infinite. e is rewritten as one fraction n/d, whose
+// Taylor series settle 0/0 forms in one pass. When they
+// don't exist at point, as with fractional powers at 0,
+// L'Hopital's rule differentiates n and d with Derive
+// instead. A limit that is infinite comes back as ±Inf
+// with an error; one that doesn't exist, like Sin(1/x)
+// at 0, is just an error.
+func Limit(e Expression, v Var, point float64, dir Direction) (float64, error) {
+	for _, w := range Variables(e) {
+		if w != v {
+			return math.NaN(), fmt.Errorf("limit in %v of an expression depending on %v", v.Name, w.Name)
+		}
+	}
+	if math.IsInf(point, 0) {
+		// x = 1/t with t going to 0 from the inside
+		t := Var{v.Name + "'"}
+		if dir == FromAbove && point > 0 || dir == FromBelow && point < 0 {
+			return math.NaN(), fmt.Errorf("can't approach %v from beyond it", point)
+		}
+		dir = FromAbove
+		if point < 0 {
+			dir = FromBelow
+		}
+		return Limit(ForwardSub(e, Pow{t, -1.}, v), t, 0, dir)
+	}
+
+	at := map[string]float64{v.Name: point}
+	n, d := fraction(e)
+	for step := 0; step <= maxLHopital; step++ {
+		// not through Simplify, which would take
+		// a small coefficient for zero
+		n, d = cancelCommon(asPoly(makePoly(n)), asPoly(makePoly(d)))
+		if l, ok, err := limitSeries(n, d, v, at, dir); ok {
+			return l, err
+		}
+		nv, dv := Eval(n, at), Eval(d, at)
+		switch {
+		case isNaNOrInf(nv) || isNaNOrInf(dv):
+			return math.NaN(), fmt.Errorf("%v has no limit at %v = %v", Read(e), v.Name, point)
+		case !negligible(dv, magnitude(d, at)):
+			return nv / dv, nil
+		case !negligible(nv, magnitude(n, at)):
+			return infinite(nv, d, v, point, dir)
+		}
+		// 0/0, differentiate and clear
+		// the new quotients
+		n, d = fraction(Div{PartialDerive(v, n), PartialDerive(v, d)})
+	}
+	return math.NaN(), fmt.Errorf("L'Hopital's rule didn't settle %v at %v = %v", Read(e), v.Name, point)
+}
+
+// cancelCommon divides n and d by the largest
+// monomial dividing both, so factors like x that
+// L'Hopital's rule would otherwise keep
+// differentiating drop out.
+func cancelCommon(n, d Poly) (Poly, Poly) {
+	var powers map[string]int
+	for _, p := range []Poly{n, d} {
+		for key := range p.terms {
+			m := make(map[string]int)
+			monomials, exponents := decomposePoly(key)
+			for i, s := range monomials {
+				m[s] += exponents[i]
+			}
+			if powers == nil {
+				powers = m
+				continue
+			}
+			for s, e := range powers {
+				if m[s] < e {
+					powers[s] = m[s]
+				}
+			}
+		}
+	}
+	var monomials []string
+	var exponents []int
+	for _, s := range sortedPowers(powers) {
+		monomials = append(monomials, s)
+		exponents = append(exponents, -powers[s])
+	}
+	key := makePolyTerm(monomials, exponents)
+	if key == "" {
+		return n, d
+	}
+	m := newPoly(map[string]float64{key: 1.})
+	return mul(n, m), mul(d, m)
+}
+
+// hasQuotient reports whether p has a negative
+// exponent or an atom that hides a division.
+func hasQuotient(p Poly) bool {
+	for key := range p.terms {
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			if exponents[i] < 0 {
+				return true
+			}
+			if !strings.HasPrefix(m, "[") {
+				continue
+			}
+			if _, d := fraction(indeterminate(m)); !isTypeEqualToFloat(Simplify(d), 1.) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isNaNOrInf(f float64) bool {
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
+
+// negligible reports whether c is zero up to the
+// rounding error of a computation whose intermediate
+// values are as big as scale. Without a finite scale
+// only an exact zero is.
+func negligible(c, scale float64) bool {
+	return c == 0 || math.Abs(c) <= 1e-10*scale
+}
+
+// limitSeries compares the leading terms of the Taylor
+// series of n and d. ok is false when the series
+// don't exist or are zero to seriesOrder. A constant
+// term counts as zero against the magnitude of the
+// value, higher ones against the biggest coefficient.
+func limitSeries(n, d Expression, v Var, at map[string]float64, dir Direction) (float64, bool, error) {
+	nj := EvalJet(n, v, at, seriesOrder)
+	dj := EvalJet(d, v, at, seriesOrder)
+	leading := func(e Expression, j Jet) int {
+		biggest := 0.
+		for _, c := range j {
+			if !isNaNOrInf(c) {
+				biggest = math.Max(biggest, math.Abs(c))
+			}
+		}
+		for k, c := range j {
+			if isNaNOrInf(c) {
+				return -2
+			}
+			scale := biggest
+			if k == 0 {
+				scale = magnitude(e, at)
+			}
+			if !negligible(c, scale) {
+				return k
+			}
+		}
+		return -1
+	}
+	kn, kd := leading(n, nj), leading(d, dj)
+	switch {
+	case kn == -2 || kd == -2 || kd == -1:
+		return 0, false, nil
+	case kn == -1:
+		// n vanishes to seriesOrder, d doesn't
+		if kd <= seriesOrder/2 {
+			return 0, true, nil
+		}
+		return 0, false, nil
+	case kn > kd:
+		return 0, true, nil
+	case kn == kd:
+		return nj[kn] / dj[kd], true, nil
+	}
+	// n/d behaves like c h^(kn-kd)
+	c := nj[kn] / dj[kd]
+	l, err := divergent(c, kd-kn, dir)
+	return l, true, err
+}
+
+// divergent is the limit of c h^-k as h goes
+// to 0 from dir.
+func divergent(c float64, k int, dir Direction) (float64, error) {
+	below := math.Copysign(math.Inf(1), c)
+	if k%2 == 1 {
+		below = -below
+	}
+	above := math.Copysign(math.Inf(1), c)
+	switch {
+	case dir == FromAbove:
+		return above, fmt.Errorf("diverges to %v", above)
+	case dir == FromBelow:
+		return below, fmt.Errorf("diverges to %v", below)
+	case above != below:
+		return math.NaN(), fmt.Errorf("diverges to %v from below and %v from above", below, above)
+	}
+	return above, fmt.Errorf("diverges to %v", above)
+}
+
+// infinite settles nv/0 by probing the sign of
+// d on either side of point.
+func infinite(nv float64, d Expression, v Var, point float64, dir Direction) (float64, error) {
+	h := 1e-6 * math.Max(1, math.Abs(point))
+	side := func(x float64) float64 {
+		return math.Copysign(math.Inf(1), nv*Eval(d, map[string]float64{v.Name: x}))
+	}
+	switch dir {
+	case FromAbove:
+		l := side(point + h)
+		return l, fmt.Errorf("diverges to %v", l)
+	case FromBelow:
+		l := side(point - h)
+		return l, fmt.Errorf("diverges to %v", l)
+	}
+	below, above := side(point-h), side(point+h)
+	if below != above {
+		return math.NaN(), fmt.Errorf("diverges to %v from below and %v from above", below, above)
+	}
+	return above, fmt.Errorf("diverges to %v", above)
+}
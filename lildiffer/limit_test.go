@@ -0,0 +1,75 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	x := Var{"x"}
+	inf := math.Inf(1)
+	table := []struct {
+		description string
+		e           Expression
+		point       float64
+		dir         Direction
+		want        float64
+	}{
+		{"Sin(x)/x", Div{Sin{x}, x}, 0, BothSides, 1},
+		{"(1-Cos(x))/x^2", Div{Add{Num{1.}, Mul{Num{-1.}, Cos{x}}}, Pow{x, 2.}}, 0, BothSides, .5},
+		{"(x^2-1)/(x-1)", Div{Add{Pow{x, 2.}, Num{-1.}}, Add{x, Num{-1.}}}, 1, BothSides, 2},
+		{"1/x - 1/Sin(x)", Add{Pow{x, -1.}, Mul{Num{-1.}, Pow{Sin{x}, -1.}}}, 0, BothSides, 0},
+		{"(x-Sin(x))/x^3", Div{Add{x, Mul{Num{-1.}, Sin{x}}}, Pow{x, 3.}}, 0, BothSides, 1. / 6},
+		{"Sin(3x)/Sin(2x)", Div{Sin{Mul{Num{3.}, x}}, Sin{Mul{Num{2.}, x}}}, 0, BothSides, 1.5},
+		{"continuous x^2 at 3", Pow{x, 2.}, 3, BothSides, 9},
+		{"x^0.5/Sin(x^0.5) from above", Div{Pow{x, .5}, Sin{Pow{x, .5}}}, 0, FromAbove, 1},
+		{"(2x^2+1)/(x^2+3) at infinity", Div{Add{Mul{Num{2.}, Pow{x, 2.}}, Num{1.}},
+			Add{Pow{x, 2.}, Num{3.}}}, inf, BothSides, 2},
+		{"x Sin(1/x) at infinity", Mul{x, Sin{Pow{x, -1.}}}, inf, BothSides, 1},
+		{"1/x at -infinity", Pow{x, -1.}, math.Inf(-1), BothSides, 0},
+		{"small (1e-12x)/x", Div{Mul{Num{1e-12}, x}, x}, 0, BothSides, 1e-12},
+		{"small Sin(1e-12x)/x", Div{Sin{Mul{Num{1e-12}, x}}, x}, 0, BothSides, 1e-12},
+		{"small 1e-11/(1e-11(x+1))", Div{Num{1e-11}, Mul{Num{1e-11}, Add{x, Num{1.}}}}, 0, BothSides, 1},
+		{"small x^0.5/(1e-11x^0.5 + 1e-11x) from above", Div{Pow{x, .5},
+			Add{Mul{Num{1e-11}, Pow{x, .5}}, Mul{Num{1e-11}, x}}}, 0, FromAbove, 1e11},
+	}
+	for _, tt := range table {
+		got, err := Limit(tt.e, x, tt.point, tt.dir)
+		tol := 1e-9
+		if tt.want != 0 {
+			tol *= math.Abs(tt.want)
+		}
+		if err != nil || math.Abs(got-tt.want) > tol {
+			t.Errorf("Limit %v got %v (%v), want %v", tt.description, got, err, tt.want)
+		}
+	}
+
+	divergent := []struct {
+		description string
+		e           Expression
+		dir         Direction
+		want        float64
+	}{
+		{"1/x from above", Pow{x, -1.}, FromAbove, inf},
+		{"1/x from below", Pow{x, -1.}, FromBelow, -inf},
+		{"1/x^2", Div{Num{1.}, Pow{x, 2.}}, BothSides, inf},
+		{"-1/x^0.5 from above", Mul{Num{-1.}, Pow{x, -.5}}, FromAbove, -inf},
+		{"Cos(x)/x^3 from below", Div{Cos{x}, Pow{x, 3.}}, FromBelow, -inf},
+	}
+	for _, tt := range divergent {
+		got, err := Limit(tt.e, x, 0, tt.dir)
+		if err == nil || got != tt.want {
+			t.Errorf("Limit %v got %v (%v), want %v and an error", tt.description, got, err, tt.want)
+		}
+	}
+
+	for _, e := range []Expression{
+		Pow{x, -1.},
+		Sin{Pow{x, -1.}},
+		Mul{x, Var{"a"}},
+	} {
+		if got, err := Limit(e, x, 0, BothSides); err == nil {
+			t.Errorf("Limit %v should fail, got %v", Read(e), got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+)
+
+// solveDense solves a x = b by Gaussian elimination
+// with partial pivoting. a and b are left untouched.
+func solveDense(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = append(append([]float64(nil), a[i]...), b[i])
+	}
+	// scale for the singularity test
+	norm := 0.
+	for _, row := range a {
+		for _, x := range row {
+			norm = math.Max(norm, math.Abs(x))
+		}
+	}
+	for col := 0; col < n; col++ {
+		p := col
+		for i := col + 1; i < n; i++ {
+			if math.Abs(m[i][col]) > math.Abs(m[p][col]) {
+				p = i
+			}
+		}
+		if math.Abs(m[p][col]) <= 1e-14*norm || m[p][col] == 0 {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		m[col], m[p] = m[p], m[col]
+		for i := col + 1; i < n; i++ {
+			f := m[i][col] / m[col][col]
+			for j := col; j <= n; j++ {
+				m[i][j] -= f * m[col][j]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		s := m[i][n]
+		for j := i + 1; j < n; j++ {
+			s -= m[i][j] * x[j]
+		}
+		x[i] = s / m[i][i]
+	}
+	return x, nil
+}
+
+// normalEquations forms (JᵀJ + mu I) and -Jᵀf, whose
+// solution is the damped least squares step.
+func normalEquations(j [][]float64, f []float64, mu float64) ([][]float64, []float64) {
+	n := len(j[0])
+	a := make([][]float64, n)
+	b := make([]float64, n)
+	for r := 0; r < n; r++ {
+		a[r] = make([]float64, n)
+		for c := 0; c < n; c++ {
+			for k := range j {
+				a[r][c] += j[k][r] * j[k][c]
+			}
+		}
+		a[r][r] += mu
+		for k := range j {
+			b[r] -= j[k][r] * f[k]
+		}
+	}
+	return a, b
+}
+
+func norm2(x []float64) float64 {
+	s := 0.
+	for _, v := range x {
+		s += v * v
+	}
+	return math.Sqrt(s)
+}
@@ -0,0 +1,369 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// Gradient returns the partial derivatives
+// of f with respect to each of vars.
+func Gradient(f Expression, vars []Var) []Expression {
+	return Jacobian([]Expression{f}, vars)[0]
+}
+
+// Hessian returns the matrix of second partial
+// derivatives of f, through a DerivativeTable so
+// the mixed partials are only computed once.
+func Hessian(f Expression, vars []Var) [][]Expression {
+	t := NewDerivativeTable(f)
+	h := make([][]Expression, len(vars))
+	for i, u := range vars {
+		h[i] = make([]Expression, len(vars))
+		for j, w := range vars {
+			m := MultiIndex{u: 1}
+			m[w]++
+			h[i][j] = t.Partial(m)
+		}
+	}
+	return h
+}
+
+// A Method is a minimization algorithm.
+type Method int
+
+const (
+	GradientDescent Method = iota
+	BFGS
+	LBFGS
+	NewtonMethod
+)
+
+// A StopReason says why Minimize returned.
+type StopReason int
+
+const (
+	GradientConverged StopReason = iota
+	FunctionConverged
+	IterationLimit
+	CallbackStopped
+	LineSearchFailed
+)
+
+func (r StopReason) String() string {
+	return [...]string{
+		"gradient converged",
+		"function converged",
+		"iteration limit",
+		"callback stopped",
+		"line search failed",
+	}[r]
+}
+
+// An Iteration is the state Minimize passes
+// to its callback after each step.
+type Iteration struct {
+	Iter     int
+	X        map[string]float64
+	F        float64
+	GradNorm float64
+}
+
+// MinimizeSettings configures Minimize. Zero
+// values pick the defaults noted.
+type MinimizeSettings struct {
+	Method Method
+	// stop once the gradient's 2-norm is
+	// within GradTol, default 1e-8
+	GradTol float64
+	// stop once a step lowers f by less than
+	// FuncTol relative to |f|, off when 0
+	FuncTol float64
+	// default 1000
+	MaxIter int
+	// L-BFGS history length, default 10
+	Memory int
+	// called after each step, returning
+	// false stops the run
+	Callback func(Iteration) bool
+}
+
+// A MinimizeResult is where Minimize stopped.
+type MinimizeResult struct {
+	X          map[string]float64
+	F          float64
+	GradNorm   float64
+	Iterations int
+	Reason     StopReason
+}
+
+// objective evaluates f and its gradient on
+// vectors ordered like vars
+type objective struct {
+	f    Expression
+	grad []Expression
+	hess [][]Expression
+	vars []Var
+	env  map[string]float64
+}
+
+func (o *objective) bind(x []float64) map[string]float64 {
+	for i, v := range o.vars {
+		o.env[v.Name] = x[i]
+	}
+	return o.env
+}
+
+func (o *objective) value(x []float64) float64 {
+	return Eval(o.f, o.bind(x))
+}
+
+func (o *objective) gradient(x []float64) []float64 {
+	env := o.bind(x)
+	g := make([]float64, len(o.grad))
+	for i, d := range o.grad {
+		g[i] = Eval(d, env)
+	}
+	return g
+}
+
+func (o *objective) hessian(x []float64) [][]float64 {
+	env := o.bind(x)
+	h := make([][]float64, len(o.hess))
+	for i := range o.hess {
+		h[i] = make([]float64, len(o.hess[i]))
+		for j, d := range o.hess[i] {
+			h[i][j] = Eval(d, env)
+		}
+	}
+	return h
+}
+
+func dot(a, b []float64) float64 {
+	s := 0.
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// axpy returns x + t*d
+func axpy(x []float64, t float64, d []float64) []float64 {
+	r := make([]float64, len(x))
+	for i := range x {
+		r[i] = x[i] + t*d[i]
+	}
+	return r
+}
+
+// backtrack shrinks the step along descent direction d
+// until it lowers f enough (the Armijo condition). It
+// returns the step length, 0 when none is found.
+func (o *objective) backtrack(x []float64, fx float64, g, d []float64) (float64, float64) {
+	slope := dot(g, d)
+	t := 1.
+	for k := 0; k < 60; k++ {
+		if ft := o.value(axpy(x, t, d)); ft <= fx+1e-4*t*slope {
+			return t, ft
+		}
+		t /= 2
+	}
+	return 0, fx
+}
+
+// Minimize finds a local minimum of f over vars from start,
+// which also binds any other variables of f. The gradient,
+// and for NewtonMethod the Hessian, are built symbolically
+// with PartialDerive once and evaluated along the way.
+// Every step is a backtracking line search along the
+// method's direction: the negative gradient, a BFGS or
+// limited memory BFGS quasi-Newton direction, or the
+// Newton direction, regularized toward the gradient when
+// the Hessian isn't positive definite.
+func Minimize(f Expression, vars []Var, start map[string]float64, s MinimizeSettings) MinimizeResult {
+	if s.GradTol == 0 {
+		s.GradTol = 1e-8
+	}
+	if s.MaxIter == 0 {
+		s.MaxIter = 1000
+	}
+	if s.Memory == 0 {
+		s.Memory = 10
+	}
+	o := &objective{f: f, grad: Gradient(f, vars), vars: vars, env: make(map[string]float64)}
+	if s.Method == NewtonMethod {
+		o.hess = Hessian(f, vars)
+	}
+	for k, v := range start {
+		o.env[k] = v
+	}
+	n := len(vars)
+	x := make([]float64, n)
+	for i, v := range vars {
+		x[i] = start[v.Name]
+	}
+	fx, g := o.value(x), o.gradient(x)
+
+	// BFGS inverse Hessian estimate
+	var h [][]float64
+	if s.Method == BFGS {
+		h = identity(n)
+	}
+	// L-BFGS history
+	var ss, ys [][]float64
+
+	result := func(iter int, reason StopReason) MinimizeResult {
+		return MinimizeResult{o.bindCopy(x), fx, norm2(g), iter, reason}
+	}
+	for iter := 0; iter < s.MaxIter; iter++ {
+		if norm2(g) <= s.GradTol {
+			return result(iter, GradientConverged)
+		}
+		var d []float64
+		switch s.Method {
+		case GradientDescent:
+			d = axpy(make([]float64, n), -1, g)
+		case BFGS:
+			d = make([]float64, n)
+			for i := range h {
+				d[i] = -dot(h[i], g)
+			}
+		case LBFGS:
+			d = lbfgsDirection(g, ss, ys)
+		case NewtonMethod:
+			d = newtonDirection(o.hessian(x), g)
+		}
+		if dot(d, g) >= 0 {
+			// not downhill, restart from the gradient
+			d = axpy(make([]float64, n), -1, g)
+			h = identity(n)
+			ss, ys = nil, nil
+		}
+
+		t, ft := o.backtrack(x, fx, g, d)
+		if t == 0 {
+			return result(iter, LineSearchFailed)
+		}
+		xt := axpy(x, t, d)
+		gt := o.gradient(xt)
+		step := axpy(xt, -1, x)
+		dg := axpy(gt, -1, g)
+		if sy := dot(step, dg); sy > 1e-12*norm2(step)*norm2(dg) {
+			switch s.Method {
+			case BFGS:
+				h = bfgsUpdate(h, step, dg, sy)
+			case LBFGS:
+				ss, ys = append(ss, step), append(ys, dg)
+				if len(ss) > s.Memory {
+					ss, ys = ss[1:], ys[1:]
+				}
+			}
+		}
+		decrease := fx - ft
+		x, fx, g = xt, ft, gt
+
+		if s.Callback != nil && !s.Callback(Iteration{iter + 1, o.bindCopy(x), fx, norm2(g)}) {
+			return result(iter+1, CallbackStopped)
+		}
+		if s.FuncTol > 0 && decrease <= s.FuncTol*math.Max(1, math.Abs(fx)) {
+			return result(iter+1, FunctionConverged)
+		}
+	}
+	if norm2(g) <= s.GradTol {
+		return result(s.MaxIter, GradientConverged)
+	}
+	return result(s.MaxIter, IterationLimit)
+}
+
+// bindCopy is the environment at x, safe
+// to hand out
+func (o *objective) bindCopy(x []float64) map[string]float64 {
+	env := o.bind(x)
+	r := make(map[string]float64, len(env))
+	for k, v := range env {
+		r[k] = v
+	}
+	return r
+}
+
+func identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+// bfgsUpdate folds the step s and gradient change
+// y into the inverse Hessian estimate h,
+// (I - ρ s yᵀ) h (I - ρ y sᵀ) + ρ s sᵀ with ρ = 1/sᵀy
+func bfgsUpdate(h [][]float64, s, y []float64, sy float64) [][]float64 {
+	n := len(s)
+	rho := 1 / sy
+	hy := make([]float64, n)
+	for i := range h {
+		hy[i] = dot(h[i], y)
+	}
+	yhy := dot(y, hy)
+	r := make([][]float64, n)
+	for i := range h {
+		r[i] = make([]float64, n)
+		for j := range h[i] {
+			r[i][j] = h[i][j] - rho*(hy[i]*s[j]+s[i]*hy[j]) +
+				(rho*rho*yhy+rho)*s[i]*s[j]
+		}
+	}
+	return r
+}
+
+// lbfgsDirection is -H g by the two loop recursion
+// over the stored steps and gradient changes
+func lbfgsDirection(g []float64, ss, ys [][]float64) []float64 {
+	q := append([]float64(nil), g...)
+	alpha := make([]float64, len(ss))
+	for i := len(ss) - 1; i >= 0; i-- {
+		alpha[i] = dot(ss[i], q) / dot(ys[i], ss[i])
+		q = axpy(q, -alpha[i], ys[i])
+	}
+	if k := len(ss) - 1; k >= 0 {
+		gamma := dot(ss[k], ys[k]) / dot(ys[k], ys[k])
+		for i := range q {
+			q[i] *= gamma
+		}
+	}
+	for i := range ss {
+		beta := dot(ys[i], q) / dot(ys[i], ss[i])
+		q = axpy(q, alpha[i]-beta, ss[i])
+	}
+	for i := range q {
+		q[i] = -q[i]
+	}
+	return q
+}
+
+// newtonDirection solves (h + mu I) d = -g, raising mu
+// from 0 until d points downhill
+func newtonDirection(h [][]float64, g []float64) []float64 {
+	neg := axpy(make([]float64, len(g)), -1, g)
+	scale := 0.
+	for i := range h {
+		for j := range h[i] {
+			scale = math.Max(scale, math.Abs(h[i][j]))
+		}
+	}
+	mu := 0.
+	for k := 0; k < 40; k++ {
+		a := make([][]float64, len(h))
+		for i := range h {
+			a[i] = append([]float64(nil), h[i]...)
+			a[i][i] += mu
+		}
+		if d, err := solveDense(a, neg); err == nil && dot(d, g) < 0 {
+			return d
+		}
+		if mu == 0 {
+			mu = 1e-8 * math.Max(1, scale)
+		}
+		mu *= 10
+	}
+	return neg
+}
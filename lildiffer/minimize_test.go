@@ -0,0 +1,102 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHessian(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	f := Add{Mul{Pow{x, 2.}, y}, Sin{y}}
+	h := Hessian(f, []Var{x, y})
+	at := map[string]float64{"x": 1.5, "y": .3}
+	want := [][]float64{{.6, 3}, {3, -math.Sin(.3)}}
+	for r := range want {
+		for c := range want[r] {
+			if got := Eval(h[r][c], at); !almostEqual(got, want[r][c]) {
+				t.Errorf("Hessian [%v][%v] got %v, want %v", r, c, got, want[r][c])
+			}
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	x, y, a := Var{"x"}, Var{"y"}, Var{"a"}
+	// (x-1)^2 + 10 (y+2)^2 + a x y
+	bowl := Add{Pow{Add{x, Num{-1.}}, 2.},
+		Add{Mul{Num{10.}, Pow{Add{y, Num{2.}}, 2.}}, Mul{a, Mul{x, y}}}}
+	// solves 2(x-1) + y = 0, 20(y+2) + x = 0 at a = 1
+	bowlMin := map[string]float64{"x": 80. / 39, "y": -82. / 39}
+	// (1-x)^2 + 100 (y-x^2)^2
+	rosenbrock := Add{Pow{Add{Num{1.}, Mul{Num{-1.}, x}}, 2.},
+		Mul{Num{100.}, Pow{Add{y, Mul{Num{-1.}, Pow{x, 2.}}}, 2.}}}
+	rosenMin := map[string]float64{"x": 1, "y": 1}
+
+	table := []struct {
+		description string
+		f           Expression
+		start       map[string]float64
+		method      Method
+		want        map[string]float64
+	}{
+		{"gradient descent on a bowl", bowl, map[string]float64{"x": 0, "y": 0, "a": 1}, GradientDescent, bowlMin},
+		{"BFGS on a bowl", bowl, map[string]float64{"x": 0, "y": 0, "a": 1}, BFGS, bowlMin},
+		{"L-BFGS on a bowl", bowl, map[string]float64{"x": 0, "y": 0, "a": 1}, LBFGS, bowlMin},
+		{"Newton on a bowl", bowl, map[string]float64{"x": 0, "y": 0, "a": 1}, NewtonMethod, bowlMin},
+		{"BFGS on Rosenbrock", rosenbrock, map[string]float64{"x": -1.2, "y": 1}, BFGS, rosenMin},
+		{"L-BFGS on Rosenbrock", rosenbrock, map[string]float64{"x": -1.2, "y": 1}, LBFGS, rosenMin},
+		{"Newton on Rosenbrock", rosenbrock, map[string]float64{"x": -1.2, "y": 1}, NewtonMethod, rosenMin},
+	}
+	for _, tt := range table {
+		r := Minimize(tt.f, []Var{x, y}, tt.start, MinimizeSettings{Method: tt.method, MaxIter: 5000})
+		if r.Reason != GradientConverged {
+			t.Errorf("Minimize %v stopped: %v after %v iterations", tt.description, r.Reason, r.Iterations)
+			continue
+		}
+		for name, want := range tt.want {
+			if math.Abs(r.X[name]-want) > 1e-6 {
+				t.Errorf("Minimize %v got %v = %v, want %v", tt.description, name, r.X[name], want)
+			}
+		}
+		if r.X["a"] != tt.start["a"] {
+			t.Errorf("Minimize %v moved the parameter a", tt.description)
+		}
+	}
+}
+
+func TestMinimizeStopping(t *testing.T) {
+	x := Var{"x"}
+	f := Add{Pow{x, 4.}, Mul{Num{-3.}, x}}
+
+	// callback sees decreasing f and can stop the run
+	var seen []float64
+	r := Minimize(f, []Var{x}, map[string]float64{"x": 3}, MinimizeSettings{
+		Method: GradientDescent,
+		Callback: func(it Iteration) bool {
+			seen = append(seen, it.F)
+			return it.Iter < 3
+		},
+	})
+	if r.Reason != CallbackStopped || r.Iterations != 3 || len(seen) != 3 {
+		t.Errorf("Minimize callback stop got %v after %v iterations, %v calls",
+			r.Reason, r.Iterations, len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] >= seen[i-1] {
+			t.Errorf("Minimize f went up from %v to %v", seen[i-1], seen[i])
+		}
+	}
+
+	r = Minimize(f, []Var{x}, map[string]float64{"x": 3}, MinimizeSettings{MaxIter: 2})
+	if r.Reason != IterationLimit || r.Iterations != 2 {
+		t.Errorf("Minimize iteration limit got %v after %v iterations", r.Reason, r.Iterations)
+	}
+
+	r = Minimize(f, []Var{x}, map[string]float64{"x": 3}, MinimizeSettings{Method: BFGS, FuncTol: 1e-6})
+	if r.Reason != FunctionConverged && r.Reason != GradientConverged {
+		t.Errorf("Minimize FuncTol got %v", r.Reason)
+	}
+	if want := math.Cbrt(.75); math.Abs(r.X["x"]-want) > 1e-3 {
+		t.Errorf("Minimize FuncTol got x = %v, want %v", r.X["x"], want)
+	}
+}
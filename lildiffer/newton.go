@@ -0,0 +1,109 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// Jacobian returns the matrix of partial derivatives
+// of fs, row i holding the partials of fs[i] with
+// respect to each of vars.
+func Jacobian(fs []Expression, vars []Var) [][]Expression {
+	j := make([][]Expression, len(fs))
+	for i, f := range fs {
+		j[i] = make([]Expression, len(vars))
+		for k, v := range vars {
+			j[i][k] = makePoly(Simplify(PartialDerive(v, f)))
+		}
+	}
+	return j
+}
+
+// A NewtonResult reports where Newton's method
+// stopped and how it got there.
+type NewtonResult struct {
+	// X binds vars, along with the
+	// other variables of the start
+	X map[string]float64
+	// Residual is the 2-norm of F at X
+	Residual   float64
+	Iterations int
+	Converged  bool
+}
+
+// Newton finds a root of the system fs = 0 in vars by
+// Newton's method, starting from start, which also binds
+// any other variables of fs. The Jacobian is built once
+// with PartialDerive and evaluated at each step. Steps are
+// damped by backtracking until the residual falls, and a
+// singular or non-square Jacobian takes a regularized
+// least squares step instead. It stops once the residual
+// is within tol or after maxIter steps.
+func Newton(fs []Expression, vars []Var, start map[string]float64, tol float64, maxIter int) NewtonResult {
+	jac := Jacobian(fs, vars)
+	x := make(map[string]float64, len(start))
+	for k, v := range start {
+		x[k] = v
+	}
+	residual := func(x map[string]float64) []float64 {
+		r := make([]float64, len(fs))
+		for i, f := range fs {
+			r[i] = Eval(f, x)
+		}
+		return r
+	}
+	f := residual(x)
+	fn := norm2(f)
+
+	iter := 0
+	for ; iter < maxIter && !(fn <= tol); iter++ {
+		j := make([][]float64, len(fs))
+		for i := range jac {
+			j[i] = make([]float64, len(vars))
+			for k := range vars {
+				j[i][k] = Eval(jac[i][k], x)
+			}
+		}
+		var dx []float64
+		var err error
+		if len(fs) == len(vars) {
+			neg := make([]float64, len(f))
+			for i := range f {
+				neg[i] = -f[i]
+			}
+			dx, err = solveDense(j, neg)
+		}
+		if dx == nil || err != nil {
+			dx, err = solveDense(normalEquations(j, f, 1e-8*(1+fn)))
+			if err != nil {
+				break
+			}
+		}
+
+		// backtrack until the residual falls enough
+		t := 1.
+		var next map[string]float64
+		var nf []float64
+		nfn := math.Inf(1)
+		for k := 0; k < 40; k++ {
+			next = make(map[string]float64, len(x))
+			for name, val := range x {
+				next[name] = val
+			}
+			for i, v := range vars {
+				next[v.Name] += t * dx[i]
+			}
+			nf = residual(next)
+			nfn = norm2(nf)
+			if nfn <= (1-1e-4*t)*fn {
+				break
+			}
+			t /= 2
+		}
+		if !(nfn < fn) {
+			// no descent along the step
+			break
+		}
+		x, f, fn = next, nf, nfn
+	}
+	return NewtonResult{x, fn, iter, fn <= tol}
+}
@@ -0,0 +1,79 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJacobian(t *testing.T) {
+	x, y := Var{"x"}, Var{"y"}
+	j := Jacobian([]Expression{Mul{x, y}, Add{Sin{x}, Pow{y, 2.}}}, []Var{x, y})
+	at := map[string]float64{"x": .5, "y": 2}
+	want := [][]float64{{2, .5}, {math.Cos(.5), 4}}
+	for r := range want {
+		for c := range want[r] {
+			if got := Eval(j[r][c], at); !almostEqual(got, want[r][c]) {
+				t.Errorf("Jacobian [%v][%v] got %v, want %v", r, c, got, want[r][c])
+			}
+		}
+	}
+}
+
+func TestNewton(t *testing.T) {
+	x, y, a := Var{"x"}, Var{"y"}, Var{"a"}
+	table := []struct {
+		description string
+		fs          []Expression
+		vars        []Var
+		start       map[string]float64
+		want        map[string]float64
+	}{
+		{"circle meets line",
+			[]Expression{Add{Pow{x, 2.}, Add{Pow{y, 2.}, Num{-4.}}}, Add{x, Mul{Num{-1.}, y}}},
+			[]Var{x, y}, map[string]float64{"x": 1, "y": .5},
+			map[string]float64{"x": math.Sqrt2, "y": math.Sqrt2},
+		},
+		{"parameter from start",
+			[]Expression{Add{Pow{x, 2.}, Mul{Num{-1.}, a}}},
+			[]Var{x}, map[string]float64{"x": 1, "a": 3},
+			map[string]float64{"x": math.Sqrt(3)},
+		},
+		{"damping keeps x/(1+x^2)^0.5 from diverging",
+			[]Expression{Mul{x, Pow{Add{Num{1.}, Pow{x, 2.}}, -.5}}},
+			[]Var{x}, map[string]float64{"x": 3},
+			map[string]float64{"x": 0},
+		},
+		{"transcendental system",
+			[]Expression{Add{Sin{x}, Mul{Num{-1.}, y}}, Add{x, Add{y, Num{-1.}}}},
+			[]Var{x, y}, map[string]float64{"x": 0, "y": 0},
+			map[string]float64{"x": 0.5109734293885691, "y": 0.4890265706114309},
+		},
+		{"double root, singular at the solution",
+			[]Expression{Pow{Add{x, Num{-1.}}, 2.}},
+			[]Var{x}, map[string]float64{"x": 2},
+			map[string]float64{"x": 1},
+		},
+		{"overdetermined, least squares steps",
+			[]Expression{Add{x, Num{-2.}}, Add{Pow{x, 2.}, Num{-4.}}},
+			[]Var{x}, map[string]float64{"x": 5},
+			map[string]float64{"x": 2},
+		},
+	}
+	for _, tt := range table {
+		r := Newton(tt.fs, tt.vars, tt.start, 1e-12, 100)
+		if !r.Converged || r.Residual > 1e-12 {
+			t.Errorf("Newton %v didn't converge: %+v", tt.description, r)
+			continue
+		}
+		for name, want := range tt.want {
+			if math.Abs(r.X[name]-want) > 1e-5 {
+				t.Errorf("Newton %v got %v = %v, want %v", tt.description, name, r.X[name], want)
+			}
+		}
+	}
+
+	r := Newton([]Expression{Add{Pow{x, 2.}, Num{1.}}}, []Var{x}, map[string]float64{"x": .5}, 1e-12, 50)
+	if r.Converged || r.Iterations > 50 || r.Residual < 1 {
+		t.Errorf("Newton x^2+1 should not converge, got %+v", r)
+	}
+}
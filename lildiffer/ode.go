@@ -0,0 +1,301 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A System of ODEs dState[i]/dTime = F[i].
+type System struct {
+	F     []Expression
+	State []Var
+	Time  Var
+	// Env binds any other variables of F
+	Env map[string]float64
+}
+
+// A Trajectory is the solution of a System,
+// the states Y at the times T with a dense
+// interpolant in between.
+type Trajectory struct {
+	T []float64
+	Y [][]float64
+	// derivatives at each time, for
+	// Hermite interpolation
+	dy [][]float64
+	// Dormand-Prince continuous extension
+	// per step, nil for Hermite
+	dense [][5][]float64
+}
+
+// At interpolates the state at time t, which must
+// lie between the first and last times.
+func (tr *Trajectory) At(t float64) []float64 {
+	n := len(tr.T)
+	dir := 1.
+	if n > 1 && tr.T[n-1] < tr.T[0] {
+		dir = -1
+	}
+	if dir*(t-tr.T[0]) < 0 || dir*(t-tr.T[n-1]) > 0 {
+		panic(fmt.Sprintf("trajectory doesn't reach t = %v", t))
+	}
+	i := sort.Search(n, func(i int) bool { return dir*tr.T[i] >= dir*t })
+	if i == 0 || tr.T[i] == t {
+		return append([]float64(nil), tr.Y[i]...)
+	}
+	i--
+	h := tr.T[i+1] - tr.T[i]
+	s := (t - tr.T[i]) / h
+	y := make([]float64, len(tr.Y[i]))
+	if tr.dense != nil {
+		r := tr.dense[i]
+		s1 := 1 - s
+		for k := range y {
+			y[k] = r[0][k] + s*(r[1][k]+s1*(r[2][k]+s*(r[3][k]+s1*r[4][k])))
+		}
+		return y
+	}
+	// cubic Hermite
+	h00, h10 := 2*s*s*s-3*s*s+1, s*s*s-2*s*s+s
+	h01, h11 := -2*s*s*s+3*s*s, s*s*s-s*s
+	for k := range y {
+		y[k] = h00*tr.Y[i][k] + h10*h*tr.dy[i][k] + h01*tr.Y[i+1][k] + h11*h*tr.dy[i+1][k]
+	}
+	return y
+}
+
+func (tr *Trajectory) push(t float64, y, dy []float64) {
+	tr.T = append(tr.T, t)
+	tr.Y = append(tr.Y, y)
+	tr.dy = append(tr.dy, dy)
+}
+
+func (s System) bind(env map[string]float64, t float64, y []float64) {
+	env[s.Time.Name] = t
+	for i, v := range s.State {
+		env[v.Name] = y[i]
+	}
+}
+
+// rhs evaluates F at (t, y)
+func (s System) rhs(env map[string]float64, t float64, y []float64) []float64 {
+	s.bind(env, t, y)
+	f := make([]float64, len(s.F))
+	for i, e := range s.F {
+		f[i] = Eval(e, env)
+	}
+	return f
+}
+
+func (s System) env() map[string]float64 {
+	env := make(map[string]float64, len(s.Env)+len(s.State)+1)
+	for k, v := range s.Env {
+		env[k] = v
+	}
+	return env
+}
+
+// RK4 integrates from y0 at t0 to t1 in steps equal
+// steps of the classical fourth order Runge-Kutta
+// method, without error control.
+func (s System) RK4(y0 []float64, t0, t1 float64, steps int) *Trajectory {
+	env := s.env()
+	h := (t1 - t0) / float64(steps)
+	y := append([]float64(nil), y0...)
+	tr := &Trajectory{}
+	f := s.rhs(env, t0, y)
+	tr.push(t0, y, f)
+	for i := 0; i < steps; i++ {
+		t := t0 + float64(i)*h
+		k1 := f
+		k2 := s.rhs(env, t+h/2, axpy(y, h/2, k1))
+		k3 := s.rhs(env, t+h/2, axpy(y, h/2, k2))
+		k4 := s.rhs(env, t+h, axpy(y, h, k3))
+		next := make([]float64, len(y))
+		for k := range y {
+			next[k] = y[k] + h/6*(k1[k]+2*k2[k]+2*k3[k]+k4[k])
+		}
+		y = next
+		f = s.rhs(env, t+h, y)
+		tr.push(t+h, y, f)
+	}
+	return tr
+}
+
+// cap on the steps of the adaptive integrators
+const maxSteps = 100000
+
+// errNorm is the root mean square of the error
+// estimate scaled by tol(1 + |y|)
+func errNorm(e, y0, y1 []float64, tol float64) float64 {
+	s := 0.
+	for k := range e {
+		sc := tol * (1 + math.Max(math.Abs(y0[k]), math.Abs(y1[k])))
+		s += (e[k] / sc) * (e[k] / sc)
+	}
+	return math.Sqrt(s / float64(len(e)))
+}
+
+// Dormand-Prince 5(4) tableau
+var (
+	dpC = [7]float64{0, 1. / 5, 3. / 10, 4. / 5, 8. / 9, 1, 1}
+	dpA = [7][6]float64{
+		{},
+		{1. / 5},
+		{3. / 40, 9. / 40},
+		{44. / 45, -56. / 15, 32. / 9},
+		{19372. / 6561, -25360. / 2187, 64448. / 6561, -212. / 729},
+		{9017. / 3168, -355. / 33, 46732. / 5247, 49. / 176, -5103. / 18656},
+		{35. / 384, 0, 500. / 1113, 125. / 192, -2187. / 6784, 11. / 84},
+	}
+	// fifth order weights less fourth order ones
+	dpE = [7]float64{71. / 57600, 0, -71. / 16695, 71. / 1920, -17253. / 339200, 22. / 525, -1. / 40}
+	// continuous extension
+	dpD = [7]float64{-12715105075. / 11282082432, 0, 87487479700. / 32700410799,
+		-10690763975. / 1880347072, 701980252875. / 199316789632,
+		-1453857185. / 822651844, 69997945. / 29380423}
+)
+
+// DormandPrince integrates from y0 at t0 to t1 by the
+// adaptive Dormand-Prince 5(4) method, keeping the local
+// error estimate within tol relative to 1 + |y|. The
+// trajectory interpolates to fourth order between
+// steps. It errors, returning the trajectory so far, when
+// the step size underflows or the step count runs out.
+func (s System) DormandPrince(y0 []float64, t0, t1, tol float64) (*Trajectory, error) {
+	env := s.env()
+	y := append([]float64(nil), y0...)
+	tr := &Trajectory{}
+	f := s.rhs(env, t0, y)
+	tr.push(t0, y, f)
+	dir := math.Copysign(1, t1-t0)
+	h := dir * initialStep(f, y, t1-t0, tol)
+	t := t0
+	for steps := 0; dir*(t1-t) > 0; steps++ {
+		if steps == maxSteps {
+			return tr, fmt.Errorf("step limit reached at t = %v", t)
+		}
+		if dir*(t+h-t1) > 0 {
+			h = t1 - t
+		}
+		var k [7][]float64
+		k[0] = f
+		for i := 1; i < 7; i++ {
+			yi := append([]float64(nil), y...)
+			for j := 0; j < i; j++ {
+				yi = axpy(yi, h*dpA[i][j], k[j])
+			}
+			k[i] = s.rhs(env, t+dpC[i]*h, yi)
+		}
+		// the last stage is at the fifth order solution
+		next := append([]float64(nil), y...)
+		for j := 0; j < 6; j++ {
+			next = axpy(next, h*dpA[6][j], k[j])
+		}
+		e := make([]float64, len(y))
+		for j := 0; j < 7; j++ {
+			e = axpy(e, h*dpE[j], k[j])
+		}
+		errn := errNorm(e, y, next, tol)
+		if errn <= 1 {
+			var r [5][]float64
+			r[0] = y
+			r[1] = axpy(next, -1, y)
+			r[2] = axpy(axpy(make([]float64, len(y)), h, k[0]), -1, r[1])
+			r[3] = axpy(axpy(r[1], -h, k[6]), -1, r[2])
+			r[4] = make([]float64, len(y))
+			for j := 0; j < 7; j++ {
+				r[4] = axpy(r[4], h*dpD[j], k[j])
+			}
+			tr.dense = append(tr.dense, r)
+			t, y, f = t+h, next, k[6]
+			tr.push(t, y, f)
+		}
+		h *= math.Min(5, math.Max(.2, .9*math.Pow(math.Max(errn, 1e-10), -.2)))
+		if math.Abs(h) <= 1e-14*math.Max(1, math.Abs(t)) {
+			return tr, fmt.Errorf("step size underflow at t = %v", t)
+		}
+	}
+	return tr, nil
+}
+
+// initialStep guesses a first step from the
+// size of the state and its derivative
+func initialStep(f, y []float64, span, tol float64) float64 {
+	d0, d1 := norm2(y), norm2(f)
+	h := .01 * math.Abs(span)
+	if d0 > 1e-5 && d1 > 1e-5 {
+		h = math.Min(h, .01*d0/d1)
+	}
+	return math.Max(h*math.Pow(tol, .2), 1e-10*math.Abs(span))
+}
+
+// Rosenbrock integrates from y0 at t0 to t1 by the
+// linearly implicit ROS2 method, second order and L-stable,
+// suited to stiff systems. Its Jacobian, including the
+// partials in Time, comes from PartialDerive and is
+// evaluated once per step; the embedded first order
+// solution controls the step against tol. Errors as
+// DormandPrince.
+func (s System) Rosenbrock(y0 []float64, t0, t1, tol float64) (*Trajectory, error) {
+	env := s.env()
+	n := len(s.State)
+	// autonomous form, time as the last state
+	jac := Jacobian(s.F, append(append([]Var(nil), s.State...), s.Time))
+	gamma := 1 + 1/math.Sqrt2
+	full := func(t float64, y []float64) []float64 {
+		return append(s.rhs(env, t, y[:n]), 1)
+	}
+
+	y := append(append([]float64(nil), y0...), t0)
+	tr := &Trajectory{}
+	f := full(t0, y)
+	tr.push(t0, y[:n], f[:n])
+	dir := math.Copysign(1, t1-t0)
+	h := dir * initialStep(f[:n], y[:n], t1-t0, tol)
+	for steps := 0; dir*(t1-y[n]) > 0; steps++ {
+		if steps == maxSteps {
+			return tr, fmt.Errorf("step limit reached at t = %v", y[n])
+		}
+		if dir*(y[n]+h-t1) > 0 {
+			h = t1 - y[n]
+		}
+		// I - gamma h J, J evaluated at y
+		s.bind(env, y[n], y[:n])
+		m := make([][]float64, n+1)
+		for i := range m {
+			m[i] = make([]float64, n+1)
+			m[i][i] = 1
+			if i == n {
+				continue
+			}
+			for j := range m[i] {
+				m[i][j] -= gamma * h * Eval(jac[i][j], env)
+			}
+		}
+		k1, err := solveDense(m, f)
+		if err != nil {
+			return tr, fmt.Errorf("singular iteration matrix at t = %v", y[n])
+		}
+		g := full(y[n]+h, axpy(y, h, k1))
+		k2, err := solveDense(m, axpy(g, -2, k1))
+		if err != nil {
+			return tr, fmt.Errorf("singular iteration matrix at t = %v", y[n])
+		}
+		next := axpy(axpy(y, 1.5*h, k1), .5*h, k2)
+		// less the embedded Euler-like y + h k1
+		e := axpy(axpy(make([]float64, n+1), .5*h, k1), .5*h, k2)
+		errn := errNorm(e[:n], y[:n], next[:n], tol)
+		if errn <= 1 {
+			next[n] = y[n] + h
+			y, f = next, full(next[n], next)
+			tr.push(y[n], y[:n], f[:n])
+		}
+		h *= math.Min(5, math.Max(.2, .9*math.Pow(math.Max(errn, 1e-10), -.5)))
+		if math.Abs(h) <= 1e-14*math.Max(1, math.Abs(y[n])) {
+			return tr, fmt.Errorf("step size underflow at t = %v", y[n])
+		}
+	}
+	return tr, nil
+}
@@ -0,0 +1,108 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestODE(t *testing.T) {
+	x, v, y, tv, k := Var{"x"}, Var{"v"}, Var{"y"}, Var{"t"}, Var{"k"}
+	oscillator := System{
+		F:     []Expression{v, Mul{Num{-1.}, Mul{k, x}}},
+		State: []Var{x, v},
+		Time:  tv,
+		Env:   map[string]float64{"k": 4},
+	}
+	// x = Cos(2t)
+	exact := func(t float64) []float64 {
+		return []float64{math.Cos(2 * t), -2 * math.Sin(2*t)}
+	}
+	// y' = t y, y = e^(t^2/2)
+	growth := System{F: []Expression{Mul{tv, y}}, State: []Var{y}, Time: tv}
+
+	type integrator func(s System, y0 []float64, t0, t1 float64) (*Trajectory, error)
+	methods := []struct {
+		name string
+		run  integrator
+		tol  float64
+	}{
+		{"RK4", func(s System, y0 []float64, t0, t1 float64) (*Trajectory, error) {
+			return s.RK4(y0, t0, t1, 2000), nil
+		}, 1e-8},
+		{"DormandPrince", func(s System, y0 []float64, t0, t1 float64) (*Trajectory, error) {
+			return s.DormandPrince(y0, t0, t1, 1e-10)
+		}, 1e-7},
+		{"Rosenbrock", func(s System, y0 []float64, t0, t1 float64) (*Trajectory, error) {
+			return s.Rosenbrock(y0, t0, t1, 1e-7)
+		}, 1e-4},
+	}
+	for _, m := range methods {
+		tr, err := m.run(oscillator, []float64{1, 0}, 0, 5)
+		if err != nil {
+			t.Errorf("%v oscillator: %v", m.name, err)
+			continue
+		}
+		for _, at := range []float64{0, .37, 2.5, 4.91, 5} {
+			got, want := tr.At(at), exact(at)
+			for i := range want {
+				if math.Abs(got[i]-want[i]) > m.tol {
+					t.Errorf("%v oscillator at %v got %v, want %v", m.name, at, got, want)
+					break
+				}
+			}
+		}
+
+		tr, err = m.run(growth, []float64{1}, 0, 2)
+		if err != nil {
+			t.Errorf("%v growth: %v", m.name, err)
+			continue
+		}
+		if got, want := tr.At(2)[0], math.Exp(2); math.Abs(got-want) > 100*m.tol*want {
+			t.Errorf("%v growth got %v, want %v", m.name, got, want)
+		}
+
+		// backwards in time
+		tr, err = m.run(growth, []float64{math.Exp(2)}, 2, 0)
+		if err != nil {
+			t.Errorf("%v backwards: %v", m.name, err)
+			continue
+		}
+		if got := tr.At(1)[0]; math.Abs(got-math.Exp(.5)) > 100*m.tol {
+			t.Errorf("%v backwards got %v, want %v", m.name, got, math.Exp(.5))
+		}
+	}
+}
+
+func TestRosenbrockStiff(t *testing.T) {
+	y, tv := Var{"y"}, Var{"t"}
+	// y' = -1000 (y - Cos(t)) hugs Cos(t) after a fast transient
+	stiff := System{
+		F:     []Expression{Mul{Num{-1000.}, Add{y, Mul{Num{-1.}, Cos{tv}}}}},
+		State: []Var{y},
+		Time:  tv,
+	}
+	// the slow solution the transient decays onto
+	slow := func(t float64) float64 {
+		return (1e6*math.Cos(t) + 1e3*math.Sin(t)) / (1e6 + 1)
+	}
+	ros, err := stiff.Rosenbrock([]float64{0}, 0, 3, 1e-4)
+	if err != nil {
+		t.Fatalf("Rosenbrock stiff: %v", err)
+	}
+	dp, err := stiff.DormandPrince([]float64{0}, 0, 3, 1e-6)
+	if err != nil {
+		t.Fatalf("DormandPrince stiff: %v", err)
+	}
+	if got := ros.At(3)[0]; math.Abs(got-slow(3)) > 1e-3 {
+		t.Errorf("Rosenbrock stiff got %v, want %v", got, slow(3))
+	}
+	if got := dp.At(3)[0]; math.Abs(got-slow(3)) > 1e-5 {
+		t.Errorf("DormandPrince stiff got %v, want %v", got, slow(3))
+	}
+	// explicit steps are held to about 3/1000
+	// by stability alone
+	if len(ros.T)*3 > len(dp.T) {
+		t.Errorf("Rosenbrock took %v steps, DormandPrince %v, expected far fewer",
+			len(ros.T), len(dp.T))
+	}
+}
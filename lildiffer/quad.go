@@ -0,0 +1,149 @@
+package lildiffer
+
+import (
+	"math"
+)
+
+// 15 point Kronrod nodes on [0, 1], the odd
+// ones shared with the 7 point Gauss rule
+var kronrodNodes = [8]float64{
+	0.991455371120812639206854697526329,
+	0.949107912342758524526189684047851,
+	0.864864423359769072789712788640926,
+	0.741531185599394439863864773280788,
+	0.586087235467691130294144845693013,
+	0.405845151377397166906606412076961,
+	0.207784955007898467600689403773245,
+	0.,
+}
+
+var kronrodWeights = [8]float64{
+	0.022935322010529224963732008058970,
+	0.063092092629978553290700663189204,
+	0.104790010322250183839876322541518,
+	0.140653259715525918745189590510238,
+	0.169004726639267902826583426598550,
+	0.190350578064785409913256402421014,
+	0.204432940075298892414161999234649,
+	0.209482141084727828012999174891714,
+}
+
+// weights of the Gauss nodes 1, 3, 5, 7 above
+var gaussWeights = [4]float64{
+	0.129484966168869693270611432679082,
+	0.279705391489276667901467771423780,
+	0.381830050505118944950369775488975,
+	0.417959183673469387755102040816327,
+}
+
+// cap on the subintervals of one adaptive run
+const maxSubintervals = 500
+
+// gaussKronrod applies the 7-15 point pair on [a, b],
+// returning the Kronrod estimate and its distance
+// from the Gauss one.
+func gaussKronrod(f func(float64) float64, a, b float64) (float64, float64) {
+	c, h := (a+b)/2, (b-a)/2
+	fc := f(c)
+	k := kronrodWeights[7] * fc
+	g := gaussWeights[3] * fc
+	for i := 0; i < 7; i++ {
+		s := f(c-h*kronrodNodes[i]) + f(c+h*kronrodNodes[i])
+		k += kronrodWeights[i] * s
+		if i%2 == 1 {
+			g += gaussWeights[i/2] * s
+		}
+	}
+	return k * h, math.Abs((k - g) * h)
+}
+
+// adaptive bisects the subinterval with the largest
+// error estimate until the total is within tol.
+func adaptive(f func(float64) float64, a, b, tol float64) (float64, float64) {
+	type piece struct{ a, b, val, err float64 }
+	val, err := gaussKronrod(f, a, b)
+	pieces := []piece{{a, b, val, err}}
+	for err > tol && len(pieces) < maxSubintervals {
+		worst := 0
+		for i, p := range pieces {
+			if p.err > pieces[worst].err {
+				worst = i
+			}
+		}
+		p := pieces[worst]
+		m := (p.a + p.b) / 2
+		if m <= p.a || m >= p.b {
+			// interval exhausted floating point
+			break
+		}
+		v1, e1 := gaussKronrod(f, p.a, m)
+		v2, e2 := gaussKronrod(f, m, p.b)
+		pieces[worst] = piece{p.a, m, v1, e1}
+		pieces = append(pieces, piece{m, p.b, v2, e2})
+		val += v1 + v2 - p.val
+		err += e1 + e2 - p.err
+	}
+	// resum to shed the rounding of the updates
+	val, err = 0, 0
+	for _, p := range pieces {
+		val += p.val
+		err += p.err
+	}
+	return val, err
+}
+
+// bind returns a copy of env with
+// name set to x
+func bind(env map[string]float64, name string, x float64) map[string]float64 {
+	r := make(map[string]float64, len(env)+1)
+	for k, val := range env {
+		r[k] = val
+	}
+	r[name] = x
+	return r
+}
+
+// Quad numerically integrates e in v from a to b,
+// with the other variables bound by env, by adaptive
+// 7-15 point Gauss-Kronrod quadrature. It returns the
+// estimate and an estimate of its absolute error; an
+// error above tol means the subdivision limit was hit,
+// usually at a singularity.
+func Quad(e Expression, v Var, a, b float64, env map[string]float64, tol float64) (float64, float64) {
+	scratch := bind(env, v.Name, 0)
+	f := func(x float64) float64 {
+		scratch[v.Name] = x
+		return Eval(e, scratch)
+	}
+	return adaptive(f, a, b, tol)
+}
+
+// QuadBox integrates e over the box lo[i] <= vars[i] <= hi[i]
+// by nesting Quad, vars[0] outermost. The error estimate
+// adds the outer one to the worst inner one times the
+// outer width. With no vars the box is a point and the
+// integral is e there.
+func QuadBox(e Expression, vars []Var, lo, hi []float64, env map[string]float64, tol float64) (float64, float64) {
+	if len(vars) != len(lo) || len(vars) != len(hi) {
+		panic("QuadBox needs bounds for every variable")
+	}
+	if len(vars) == 0 {
+		return Eval(e, env), 0
+	}
+	if len(vars) == 1 {
+		return Quad(e, vars[0], lo[0], hi[0], env, tol)
+	}
+	width := math.Abs(hi[0] - lo[0])
+	if width == 0 {
+		return 0, 0
+	}
+	inner := 0.
+	f := func(x float64) float64 {
+		val, err := QuadBox(e, vars[1:], lo[1:], hi[1:],
+			bind(env, vars[0].Name, x), tol/(2*width))
+		inner = math.Max(inner, err)
+		return val
+	}
+	val, err := adaptive(f, lo[0], hi[0], tol/2)
+	return val, err + width*inner
+}
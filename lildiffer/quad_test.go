@@ -0,0 +1,63 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuad(t *testing.T) {
+	x, a := Var{"x"}, Var{"a"}
+	table := []struct {
+		description string
+		e           Expression
+		lo, hi      float64
+		env         map[string]float64
+		want        float64
+	}{
+		{"x^2", Pow{x, 2.}, 0, 3, nil, 9},
+		{"Sin(x) over a period", Sin{x}, 0, 2 * math.Pi, nil, 0},
+		{"Cos(a x)", Cos{Mul{a, x}}, 0, 1, map[string]float64{"a": 3}, math.Sin(3) / 3},
+		{"1/(1+x^2)", Div{Num{1.}, Add{Num{1.}, Pow{x, 2.}}}, -1, 1, nil, math.Pi / 2},
+		{"sqrt(x), singular derivative", Pow{x, .5}, 0, 1, nil, 2. / 3},
+		{"reversed bounds", Pow{x, 3.}, 2, 0, nil, -4},
+		{"oscillatory Sin(50x)^2", Pow{Sin{Mul{Num{50.}, x}}, 2.}, 0, math.Pi, nil, math.Pi / 2},
+	}
+	for _, tt := range table {
+		got, err := Quad(tt.e, x, tt.lo, tt.hi, tt.env, 1e-10)
+		if err > 1e-10 || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Quad %v got %v ± %v, want %v", tt.description, got, err, tt.want)
+		}
+	}
+
+	// integrating a derivative recovers the difference
+	e := Mul{Sin{Pow{x, 2.}}, Cos{x}}
+	got, _ := Quad(Derive(e), x, .2, 1.7, nil, 1e-10)
+	want := Eval(e, map[string]float64{"x": 1.7}) - Eval(e, map[string]float64{"x": .2})
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("Quad of Derive got %v, want %v", got, want)
+	}
+}
+
+func TestQuadBox(t *testing.T) {
+	x, y, z := Var{"x"}, Var{"y"}, Var{"z"}
+	table := []struct {
+		description string
+		e           Expression
+		vars        []Var
+		lo, hi      []float64
+		want        float64
+	}{
+		{"x y", Mul{x, y}, []Var{x, y}, []float64{0, 0}, []float64{1, 2}, 1},
+		{"Sin(x+y)", Sin{Add{x, y}}, []Var{x, y},
+			[]float64{0, 0}, []float64{math.Pi / 2, math.Pi / 2}, 2},
+		{"x^2 + y^2 + z^2 on the unit cube", Add{Pow{x, 2.}, Add{Pow{y, 2.}, Pow{z, 2.}}},
+			[]Var{x, y, z}, []float64{0, 0, 0}, []float64{1, 1, 1}, 1},
+		{"no variables", Num{3.}, nil, nil, nil, 3},
+	}
+	for _, tt := range table {
+		got, err := QuadBox(tt.e, tt.vars, tt.lo, tt.hi, nil, 1e-9)
+		if err > 1e-9 || math.Abs(got-tt.want) > 1e-8 {
+			t.Errorf("QuadBox %v got %v ± %v, want %v", tt.description, got, err, tt.want)
+		}
+	}
+}
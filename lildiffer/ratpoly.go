@@ -0,0 +1,201 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// RatPoly is a polynomial with exact rational
+// coefficients. Terms are keyed by the same
+// monomial strings Poly uses, e.g. "x^2y".
+type RatPoly struct {
+	terms map[string]*big.Rat
+}
+
+// NewRatPoly builds a RatPoly, reducing the monomial
+// keys and dropping zero coefficients. Keys that don't
+// parse, or that reduce to the same monomial, are errors.
+func NewRatPoly(m map[string]*big.Rat) (RatPoly, error) {
+	r := make(map[string]*big.Rat)
+	for key, value := range m {
+		if err := checkKey(key); err != nil {
+			return RatPoly{}, err
+		}
+		key = reduce(key)
+		if _, ok := r[key]; ok {
+			return RatPoly{}, fmt.Errorf("monomial %v repeats", key)
+		}
+		if value.Sign() == 0 {
+			continue
+		}
+		r[key] = new(big.Rat).Set(value)
+	}
+	return RatPoly{r}, nil
+}
+
+// ToRatPoly converts a Poly to exact coefficients.
+// Coefficients that sit within float noise of a small
+// fraction (like 0.5 or 1/3) are snapped to it.
+func ToRatPoly(p Poly) RatPoly {
+	r := make(map[string]*big.Rat)
+	for key, value := range p.terms {
+		if almostEqual(value, 0.) {
+			continue
+		}
+		r[key] = ratFromFloat(value)
+	}
+	return RatPoly{r}
+}
+
+// Poly converts back to float coefficients.
+func (p RatPoly) Poly() Poly {
+	r := make(map[string]float64)
+	for key, value := range p.terms {
+		f, _ := value.Float64()
+		r[key] = f
+	}
+	return Poly{r}
+}
+
+// Coefficient returns the coefficient of the
+// monomial term, zero if absent.
+func (p RatPoly) Coefficient(term string) *big.Rat {
+	if c, ok := p.terms[reduce(term)]; ok {
+		return new(big.Rat).Set(c)
+	}
+	return new(big.Rat)
+}
+
+// IsZero reports whether p has no terms.
+func (p RatPoly) IsZero() bool {
+	return len(p.terms) == 0
+}
+
+// Equal reports whether p and q have identical terms.
+func (p RatPoly) Equal(q RatPoly) bool {
+	if len(p.terms) != len(q.terms) {
+		return false
+	}
+	for key, value := range p.terms {
+		w, ok := q.terms[key]
+		if !ok || value.Cmp(w) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String prints terms in sorted key order,
+// e.g. "-1/2y + y^2".
+func (p RatPoly) String() string {
+	if len(p.terms) == 0 {
+		return "0"
+	}
+	var keys []string
+	for key := range p.terms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var ret string
+	for i, key := range keys {
+		if i > 0 {
+			ret += " + "
+		}
+		c := p.terms[key]
+		switch {
+		case key == "":
+			ret += c.RatString()
+		case c.Cmp(big.NewRat(1, 1)) == 0:
+			ret += key
+		default:
+			ret += fmt.Sprintf("%v%v", c.RatString(), key)
+		}
+	}
+	return ret
+}
+
+// AddRat returns p + q.
+func AddRat(p, q RatPoly) RatPoly {
+	r := make(map[string]*big.Rat)
+	for key, value := range p.terms {
+		r[key] = new(big.Rat).Set(value)
+	}
+	for key, value := range q.terms {
+		if v, ok := r[key]; ok {
+			v.Add(v, value)
+			if v.Sign() == 0 {
+				delete(r, key)
+			}
+			continue
+		}
+		r[key] = new(big.Rat).Set(value)
+	}
+	return RatPoly{r}
+}
+
+// MulRat returns p * q.
+func MulRat(p, q RatPoly) RatPoly {
+	r := make(map[string]*big.Rat)
+	for k1, v1 := range p.terms {
+		for k2, v2 := range q.terms {
+			key := reduce(k1 + k2)
+			t := new(big.Rat).Mul(v1, v2)
+			if v, ok := r[key]; ok {
+				v.Add(v, t)
+			} else {
+				r[key] = t
+			}
+			if r[key].Sign() == 0 {
+				delete(r, key)
+			}
+		}
+	}
+	return RatPoly{r}
+}
+
+// ScaleRat returns c * p.
+func ScaleRat(p RatPoly, c *big.Rat) RatPoly {
+	r := make(map[string]*big.Rat)
+	if c.Sign() == 0 {
+		return RatPoly{r}
+	}
+	for key, value := range p.terms {
+		r[key] = new(big.Rat).Mul(value, c)
+	}
+	return RatPoly{r}
+}
+
+// ratFromFloat finds the simplest fraction within
+// float tolerance of f by walking its continued
+// fraction. Falls back to the exact binary value.
+func ratFromFloat(f float64) *big.Rat {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		panic("non-finite coefficient")
+	}
+	x := f
+	// convergents h/k
+	h0, h1 := int64(0), int64(1)
+	k0, k1 := int64(1), int64(0)
+	for i := 0; i < 40; i++ {
+		a := math.Floor(x)
+		if math.Abs(a) > 1e12 {
+			break
+		}
+		ai := int64(a)
+		h0, h1 = h1, ai*h1+h0
+		k0, k1 = k1, ai*k1+k0
+		if k1 > 1e9 {
+			break
+		}
+		if almostEqual(float64(h1)/float64(k1), f) {
+			return big.NewRat(h1, k1)
+		}
+		if x == a {
+			break
+		}
+		x = 1 / (x - a)
+	}
+	return new(big.Rat).SetFloat64(f)
+}
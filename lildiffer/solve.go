@@ -0,0 +1,460 @@
+package lildiffer
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Solution binds each solved variable to its
+// value, ready to ForwardSub back into the
+// equations.
+type Solution map[Var]Expression
+
+// Solve finds the solutions of eqs = 0 in vars. Systems
+// linear in vars are solved exactly by Gaussian elimination,
+// their coefficients free to be expressions in other
+// variables; a symbolic pivot is assumed nonzero. A single
+// polynomial equation in one variable is solved in closed
+// form up to degree 4, and beyond that when it factors
+// over the rationals into pieces of degree 4 or less. Only
+// real roots are returned. Anything else, like a
+// quintic that doesn't factor or x in Sin(x), is an error,
+// as is an empty list of equations or variables.
+func Solve(eqs []Expression, vars []Var) ([]Solution, error) {
+	if len(eqs) == 0 || len(vars) == 0 {
+		return nil, fmt.Errorf("Solve needs equations and variables, got %v and %v", len(eqs), len(vars))
+	}
+	ps := make([]Poly, len(eqs))
+	for i, e := range eqs {
+		ps[i] = polyOf(e)
+	}
+	if a, b, ok := linearSystem(ps, vars); ok {
+		s, err := solveLinear(a, b, vars)
+		if err != nil {
+			return nil, err
+		}
+		return []Solution{s}, nil
+	}
+	if len(vars) == 1 && len(ps) == 1 {
+		return solveUnivariate(ps[0], vars[0])
+	}
+	return nil, fmt.Errorf("no closed form for a nonlinear system in %v variables", len(vars))
+}
+
+func dependsOnAny(e Expression, vars []Var) bool {
+	for _, v := range vars {
+		if !isConstant(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// constantOf returns the value of p
+// when it is a constant.
+func constantOf(p Poly) (float64, bool) {
+	switch len(p.terms) {
+	case 0:
+		return 0, true
+	case 1:
+		c, ok := p.terms[""]
+		return c, ok
+	}
+	return 0, false
+}
+
+func scale(p Poly, c float64) Poly {
+	return mul(p, Poly{map[string]float64{"": c}})
+}
+
+// polyExpression is p, or a Num when
+// p is constant
+func polyExpression(p Poly) Expression {
+	if c, ok := constantOf(p); ok {
+		return Num{c}
+	}
+	return p
+}
+
+// linearSystem splits each p into coefficients of vars
+// and a right hand side, a[i]·vars = b[i]. ok is false
+// when some p isn't linear in vars.
+func linearSystem(ps []Poly, vars []Var) ([][]Poly, []Poly, bool) {
+	index := make(map[string]int)
+	for j, v := range vars {
+		index[polyName(v)] = j
+	}
+	a := make([][]Poly, len(ps))
+	b := make([]Poly, len(ps))
+	for i, p := range ps {
+		a[i] = make([]Poly, len(vars))
+		for j := range vars {
+			a[i][j] = Poly{map[string]float64{}}
+		}
+		b[i] = Poly{map[string]float64{}}
+		for key, coef := range p.terms {
+			col := -1
+			var rest []string
+			var restExp []int
+			monomials, exponents := decomposePoly(key)
+			for k, m := range monomials {
+				if j, ok := index[m]; ok {
+					if exponents[k] != 1 || col >= 0 {
+						return nil, nil, false
+					}
+					col = j
+					continue
+				}
+				if strings.HasPrefix(m, "[") && dependsOnAny(indeterminate(m), vars) {
+					return nil, nil, false
+				}
+				rest = append(rest, m)
+				restExp = append(restExp, exponents[k])
+			}
+			term := Poly{map[string]float64{makePolyTerm(rest, restExp): coef}}
+			if col < 0 {
+				b[i] = add(b[i], scale(term, -1))
+				continue
+			}
+			a[i][col] = add(a[i][col], term)
+		}
+	}
+	return a, b, true
+}
+
+// solveLinear eliminates below the diagonal, without
+// division unless the pivot is a number, then
+// substitutes back keeping numerators and denominators
+// apart.
+func solveLinear(a [][]Poly, b []Poly, vars []Var) (Solution, error) {
+	m, n := len(a), len(vars)
+	// an equation free of vars settles
+	// nothing but can still be false
+	for i := range a {
+		free := true
+		for j := range a[i] {
+			free = free && len(a[i][j].terms) == 0
+		}
+		if free && len(b[i].terms) != 0 {
+			return nil, fmt.Errorf("the system is inconsistent")
+		}
+	}
+	row := 0
+	for col := 0; col < n; col++ {
+		r := row
+		for r < m && len(a[r][col].terms) == 0 {
+			r++
+		}
+		if r == m {
+			return nil, fmt.Errorf("%v is left free, the system is underdetermined", vars[col].Name)
+		}
+		a[row], a[r] = a[r], a[row]
+		b[row], b[r] = b[r], b[row]
+		p := a[row][col]
+		for i := row + 1; i < m; i++ {
+			f := a[i][col]
+			if len(f.terms) == 0 {
+				continue
+			}
+			if c, ok := constantOf(p); ok {
+				s := scale(f, -1/c)
+				for j := col; j < n; j++ {
+					a[i][j] = add(a[i][j], mul(s, a[row][j]))
+				}
+				b[i] = add(b[i], mul(s, b[row]))
+				continue
+			}
+			g := scale(f, -1)
+			for j := col; j < n; j++ {
+				a[i][j] = add(mul(p, a[i][j]), mul(g, a[row][j]))
+			}
+			b[i] = add(mul(p, b[i]), mul(g, b[row]))
+		}
+		row++
+	}
+	for i := row; i < m; i++ {
+		if len(b[i].terms) != 0 {
+			return nil, fmt.Errorf("the system is inconsistent")
+		}
+	}
+
+	one := Poly{map[string]float64{"": 1.}}
+	num := make([]Poly, n)
+	den := make([]Poly, n)
+	s := make(Solution)
+	for i := n - 1; i >= 0; i-- {
+		rn, rd := b[i], one
+		for j := i + 1; j < n; j++ {
+			if len(a[i][j].terms) == 0 {
+				continue
+			}
+			tn, td := mul(a[i][j], num[j]), den[j]
+			if reflect.DeepEqual(rd.terms, td.terms) {
+				rn = add(rn, scale(tn, -1))
+				continue
+			}
+			rn = add(mul(rn, td), scale(mul(tn, rd), -1))
+			rd = mul(rd, td)
+		}
+		num[i], den[i] = cancelCommon(rn, mul(rd, a[i][i]))
+		if c, ok := constantOf(den[i]); ok {
+			num[i], den[i] = scale(num[i], 1/c), one
+			s[vars[i]] = polyExpression(num[i])
+			continue
+		}
+		s[vars[i]] = Div{polyExpression(num[i]), den[i]}
+	}
+	return s, nil
+}
+
+// solveUnivariate solves p = 0 for v
+func solveUnivariate(p Poly, v Var) ([]Solution, error) {
+	name := polyName(v)
+	coefs := make(map[int]Poly)
+	low, high := 0, 0
+	for key, coef := range p.terms {
+		n := 0
+		var rest []string
+		var restExp []int
+		monomials, exponents := decomposePoly(key)
+		for i, m := range monomials {
+			if m == name {
+				n = exponents[i]
+				continue
+			}
+			if e := indeterminate(m); strings.HasPrefix(m, "[") && !isConstant(v, e) {
+				return nil, fmt.Errorf("%v appears inside %v, no closed form", v.Name, Read(e))
+			}
+			rest = append(rest, m)
+			restExp = append(restExp, exponents[i])
+		}
+		if _, ok := coefs[n]; !ok {
+			coefs[n] = Poly{map[string]float64{}}
+		}
+		coefs[n] = add(coefs[n], Poly{map[string]float64{makePolyTerm(rest, restExp): coef}})
+		if n < low {
+			low = n
+		}
+		if n > high {
+			high = n
+		}
+	}
+	// negative powers, multiply through
+	// and rule out v = 0 after
+	shift := -low
+	cs := make([]Poly, high+shift+1)
+	for i := range cs {
+		cs[i] = Poly{map[string]float64{}}
+		if c, ok := coefs[i-shift]; ok {
+			cs[i] = c
+		}
+	}
+	if len(cs) == 1 {
+		if len(cs[0].terms) == 0 {
+			return nil, fmt.Errorf("every %v is a solution", v.Name)
+		}
+		return nil, nil
+	}
+
+	numeric := make([]float64, len(cs))
+	for i, c := range cs {
+		f, ok := constantOf(c)
+		if !ok {
+			return solveSymbolic(cs, v)
+		}
+		numeric[i] = f
+	}
+	roots, err := realRoots(numeric)
+	if err != nil {
+		return nil, err
+	}
+	var solutions []Solution
+	for _, r := range roots {
+		if shift > 0 && r == 0 {
+			continue
+		}
+		solutions = append(solutions, Solution{v: Num{r}})
+	}
+	return solutions, nil
+}
+
+// solveSymbolic handles linear and quadratic
+// equations whose coefficients are expressions
+func solveSymbolic(cs []Poly, v Var) ([]Solution, error) {
+	switch len(cs) {
+	case 2:
+		x := Div{polyExpression(scale(cs[0], -1)), polyExpression(cs[1])}
+		return []Solution{{v: x}}, nil
+	case 3:
+		a, b, c := cs[2], cs[1], cs[0]
+		disc := add(mul(b, b), scale(mul(a, c), -4))
+		root := Pow{polyExpression(disc), .5}
+		var solutions []Solution
+		for _, sign := range []float64{1, -1} {
+			x := Div{Add{polyExpression(scale(b, -1)), Mul{Num{sign}, root}},
+				polyExpression(scale(a, 2))}
+			solutions = append(solutions, Solution{v: Simplify(x)})
+		}
+		return solutions, nil
+	}
+	return nil, fmt.Errorf("no closed form for a degree %v equation with symbolic coefficients in %v",
+		len(cs)-1, v.Name)
+}
+
+// realRoots returns the sorted distinct real roots
+// of the polynomial with coefficients cs, constant
+// term first.
+func realRoots(cs []float64) ([]float64, error) {
+	for len(cs) > 1 && cs[len(cs)-1] == 0 {
+		cs = cs[:len(cs)-1]
+	}
+	var roots []float64
+	if len(cs) <= 5 {
+		roots = closedRoots(cs)
+	} else {
+		// split into rational factors
+		m := make(map[string]float64)
+		for i, c := range cs {
+			if c != 0 {
+				m[makePolyTerm([]string{"x"}, []int{i})] = c
+			}
+		}
+		_, factors := FactorPoly(ToRatPoly(Poly{m}))
+		for _, f := range factors {
+			u := toUpoly(f.P, "x")
+			if u.deg() > 4 {
+				return nil, fmt.Errorf("no closed form for an irreducible factor of degree %v", u.deg())
+			}
+			fs := make([]float64, len(u))
+			for i, c := range u {
+				fs[i], _ = c.Float64()
+			}
+			roots = append(roots, closedRoots(fs)...)
+		}
+	}
+
+	// polish against the whole polynomial
+	// and drop repeats
+	for i, r := range roots {
+		for k := 0; k < 3; k++ {
+			p, dp := 0., 0.
+			for j := len(cs) - 1; j >= 0; j-- {
+				dp = dp*r + p
+				p = p*r + cs[j]
+			}
+			if dp == 0 {
+				break
+			}
+			r -= p / dp
+		}
+		roots[i] = r
+	}
+	sort.Float64s(roots)
+	var distinct []float64
+	for _, r := range roots {
+		if n := len(distinct); n > 0 && math.Abs(r-distinct[n-1]) < 1e-7*math.Max(1, math.Abs(r)) {
+			continue
+		}
+		distinct = append(distinct, r)
+	}
+	return distinct, nil
+}
+
+// closedRoots solves polynomials up to degree 4
+// by formula, constant term first
+func closedRoots(cs []float64) []float64 {
+	switch len(cs) {
+	case 2:
+		return []float64{-cs[0] / cs[1]}
+	case 3:
+		return quadraticRoots(cs[2], cs[1], cs[0])
+	case 4:
+		return cubicRoots(cs[3], cs[2], cs[1], cs[0])
+	case 5:
+		return quarticRoots(cs[4], cs[3], cs[2], cs[1], cs[0])
+	}
+	return nil
+}
+
+// real roots of a x^2 + b x + c
+func quadraticRoots(a, b, c float64) []float64 {
+	disc := b*b - 4*a*c
+	if math.Abs(disc) <= 1e-12*(b*b+math.Abs(4*a*c)) {
+		return []float64{-b / (2 * a)}
+	}
+	if disc < 0 {
+		return nil
+	}
+	// avoid cancellation in the smaller root
+	q := -(b + math.Copysign(math.Sqrt(disc), b)) / 2
+	return []float64{q / a, c / q}
+}
+
+// real roots of a x^3 + b x^2 + c x + d, via
+// the depressed cubic t^3 + p t + q
+func cubicRoots(a, b, c, d float64) []float64 {
+	b, c, d = b/a, c/a, d/a
+	p := c - b*b/3
+	q := 2*b*b*b/27 - b*c/3 + d
+	shift := -b / 3
+	disc := q*q/4 + p*p*p/27
+	scale := math.Max(1, math.Max(math.Abs(p*p*p), q*q))
+	switch {
+	case math.Abs(disc) <= 1e-12*scale:
+		if math.Abs(p) <= 1e-12 {
+			return []float64{shift}
+		}
+		return []float64{3*q/p + shift, -3*q/(2*p) + shift}
+	case disc > 0:
+		s := math.Sqrt(disc)
+		return []float64{math.Cbrt(-q/2+s) + math.Cbrt(-q/2-s) + shift}
+	}
+	// three real roots, trigonometrically
+	r := 2 * math.Sqrt(-p/3)
+	phi := math.Acos(math.Max(-1, math.Min(1, 3*q/(p*r))))
+	var roots []float64
+	for k := 0; k < 3; k++ {
+		roots = append(roots, r*math.Cos(phi/3-2*math.Pi*float64(k)/3)+shift)
+	}
+	return roots
+}
+
+// real roots of a x^4 + b x^3 + c x^2 + d x + e by
+// Ferrari's method on the depressed quartic
+// y^4 + p y^2 + q y + r
+func quarticRoots(a, b, c, d, e float64) []float64 {
+	b, c, d, e = b/a, c/a, d/a, e/a
+	p := c - 3*b*b/8
+	q := d - b*c/2 + b*b*b/8
+	r := e - b*d/4 + b*b*c/16 - 3*b*b*b*b/256
+	shift := -b / 4
+	var ys []float64
+	if math.Abs(q) <= 1e-12 {
+		// biquadratic
+		for _, z := range quadraticRoots(1, p, r) {
+			switch {
+			case z > 0:
+				ys = append(ys, math.Sqrt(z), -math.Sqrt(z))
+			case math.Abs(z) <= 1e-12:
+				ys = append(ys, 0)
+			}
+		}
+	} else {
+		// completing the square with the largest
+		// root m of the resolvent cubic
+		m := math.Inf(-1)
+		for _, root := range cubicRoots(8, 8*p, 2*p*p-8*r, -q*q) {
+			m = math.Max(m, root)
+		}
+		s := math.Sqrt(2 * m)
+		ys = append(ys, quadraticRoots(1, -s, p/2+m+q/(2*s))...)
+		ys = append(ys, quadraticRoots(1, s, p/2+m-q/(2*s))...)
+	}
+	for i := range ys {
+		ys[i] += shift
+	}
+	return ys
+}
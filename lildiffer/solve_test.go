@@ -0,0 +1,209 @@
+package lildiffer
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// residuals substitutes s into eqs and
+// evaluates them at env
+func residuals(eqs []Expression, s Solution, env map[string]float64) []float64 {
+	var r []float64
+	for _, e := range eqs {
+		for v, x := range s {
+			e = ForwardSub(e, x, v)
+		}
+		r = append(r, Eval(e, env))
+	}
+	return r
+}
+
+func TestSolveLinear(t *testing.T) {
+	x, y, z, a, b := Var{"x"}, Var{"y"}, Var{"z"}, Var{"a"}, Var{"b"}
+	table := []struct {
+		description string
+		eqs         []Expression
+		vars        []Var
+		env         map[string]float64
+		want        map[string]float64
+	}{
+		{"3x3 numeric",
+			[]Expression{
+				Add{x, Add{y, Add{z, Num{-6.}}}},
+				Add{Mul{Num{2.}, x}, Add{Mul{Num{-1.}, y}, Add{z, Num{-3.}}}},
+				Add{x, Add{Mul{Num{2.}, y}, Add{Mul{Num{-1.}, z}, Num{-2.}}}},
+			},
+			[]Var{x, y, z}, nil,
+			map[string]float64{"x": 1, "y": 2, "z": 3},
+		},
+		{"zero leading pivot",
+			[]Expression{
+				Add{y, Num{-4.}},
+				Add{x, Mul{Num{-1.}, y}},
+			},
+			[]Var{x, y}, nil,
+			map[string]float64{"x": 4, "y": 4},
+		},
+		{"symbolic right hand side",
+			[]Expression{
+				Add{x, Add{y, Mul{Num{-1.}, a}}},
+				Add{x, Add{Mul{Num{-1.}, y}, Mul{Num{-1.}, b}}},
+			},
+			[]Var{x, y}, map[string]float64{"a": 5, "b": 1},
+			map[string]float64{"x": 3, "y": 2},
+		},
+		{"symbolic coefficients",
+			[]Expression{
+				Add{Mul{a, x}, Add{y, Num{-1.}}},
+				Add{x, Add{Mul{b, y}, Num{-2.}}},
+			},
+			[]Var{x, y}, map[string]float64{"a": 2, "b": 3},
+			map[string]float64{"x": .2, "y": .6},
+		},
+		{"overdetermined but consistent",
+			[]Expression{
+				Add{x, Num{-1.}},
+				Add{Mul{Num{2.}, x}, Num{-2.}},
+			},
+			[]Var{x}, nil,
+			map[string]float64{"x": 1},
+		},
+	}
+	for _, tt := range table {
+		s, err := Solve(tt.eqs, tt.vars)
+		if err != nil || len(s) != 1 {
+			t.Errorf("Solve %v got %v, %v", tt.description, s, err)
+			continue
+		}
+		got := make(map[string]float64)
+		for v, e := range s[0] {
+			got[v.Name] = Eval(e, tt.env)
+		}
+		for v, want := range tt.want {
+			if !almostEqual(got[v], want) {
+				t.Errorf("Solve %v got %v = %v, want %v", tt.description, v, got[v], want)
+			}
+		}
+		for _, r := range residuals(tt.eqs, s[0], tt.env) {
+			if !almostEqual(r, 0) {
+				t.Errorf("Solve %v leaves residual %v", tt.description, r)
+			}
+		}
+	}
+
+	for _, eqs := range [][]Expression{
+		{Add{x, Add{y, Num{-1.}}}},
+		{Add{x, Add{y, Num{-1.}}}, Add{Mul{Num{2.}, x}, Add{Mul{Num{2.}, y}, Num{-3.}}}},
+	} {
+		if s, err := Solve(eqs, []Var{x, y}); err == nil {
+			t.Errorf("Solve %v should fail, got %v", eqs, s)
+		}
+	}
+	// a false constant equation is inconsistent
+	// however many variables it leaves free
+	for _, eqs := range [][]Expression{
+		{Num{5.}},
+		{Add{x, Num{-1.}}, Num{5.}},
+	} {
+		if s, err := Solve(eqs, []Var{x, y}); err == nil || !strings.Contains(err.Error(), "inconsistent") {
+			t.Errorf("Solve %v got %v, %v, want inconsistent", eqs, s, err)
+		}
+	}
+	if s, err := Solve(nil, []Var{x}); err == nil {
+		t.Errorf("Solve with no equations should fail, got %v", s)
+	}
+	if s, err := Solve([]Expression{x}, nil); err == nil {
+		t.Errorf("Solve with no variables should fail, got %v", s)
+	}
+}
+
+func TestSolveUnivariate(t *testing.T) {
+	x := Var{"x"}
+	// product of (x - r) over roots
+	roots := func(rs ...float64) Expression {
+		var e Expression = Num{1.}
+		for _, r := range rs {
+			e = Mul{e, Add{x, Num{-r}}}
+		}
+		return e
+	}
+	sqrt2, sqrt3 := math.Sqrt(2), math.Sqrt(3)
+	table := []struct {
+		description string
+		e           Expression
+		want        []float64
+	}{
+		{"linear", Add{Mul{Num{4.}, x}, Num{2.}}, []float64{-.5}},
+		{"quadratic", roots(2, 3), []float64{2, 3}},
+		{"double root", roots(1.5, 1.5), []float64{1.5}},
+		{"no real roots", Add{Pow{x, 2.}, Num{1.}}, nil},
+		{"cubic, three real roots", roots(1, 2, 3), []float64{1, 2, 3}},
+		{"cubic, one real root", Mul{Add{x, Num{1.}}, Add{Pow{x, 2.}, Add{Mul{Num{-1.}, x}, Num{2.}}}}, []float64{-1}},
+		{"biquadratic", Mul{Add{Pow{x, 2.}, Num{-2.}}, Add{Pow{x, 2.}, Num{-3.}}},
+			[]float64{-sqrt3, -sqrt2, sqrt2, sqrt3}},
+		{"quartic", roots(-3, 1, 2, 4), []float64{-3, 1, 2, 4}},
+		{"sextic that factors", Mul{roots(-1, 1, 5), Mul{Add{Pow{x, 2.}, Num{-2.}},
+			Add{Pow{x, 2.}, Add{x, Num{1.}}}}}, []float64{-sqrt2, -1, 1, sqrt2, 5}},
+		{"negative powers", Add{x, Add{Pow{x, -1.}, Num{-2.5}}}, []float64{.5, 2}},
+	}
+	for _, tt := range table {
+		s, err := Solve([]Expression{tt.e}, []Var{x})
+		if err != nil {
+			t.Errorf("Solve %v: %v", tt.description, err)
+			continue
+		}
+		var got []float64
+		for _, sol := range s {
+			got = append(got, Eval(sol[x], nil))
+			for _, r := range residuals([]Expression{tt.e}, sol, nil) {
+				if math.Abs(r) > 1e-8 {
+					t.Errorf("Solve %v leaves residual %v", tt.description, r)
+				}
+			}
+		}
+		want := tt.want
+		if len(got) != len(want) {
+			t.Errorf("Solve %v got %v, want %v", tt.description, got, want)
+			continue
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-9 {
+				t.Errorf("Solve %v got %v, want %v", tt.description, got, want)
+				break
+			}
+		}
+	}
+
+	for _, e := range []Expression{
+		Add{Pow{x, 5.}, Add{Mul{Num{-1.}, x}, Num{-1.}}},
+		Add{Sin{x}, Num{-.5}},
+		Add{Mul{Var{"a"}, Pow{x, 3.}}, Num{1.}},
+	} {
+		if s, err := Solve([]Expression{e}, []Var{x}); err == nil {
+			t.Errorf("Solve %v should fail, got %v", Read(e), s)
+		}
+	}
+}
+
+func TestSolveSymbolicQuadratic(t *testing.T) {
+	x, a, b := Var{"x"}, Var{"a"}, Var{"b"}
+	// x^2 + b x - a = 0
+	e := Add{Pow{x, 2.}, Add{Mul{b, x}, Mul{Num{-1.}, a}}}
+	s, err := Solve([]Expression{e}, []Var{x})
+	if err != nil || len(s) != 2 {
+		t.Fatalf("Solve got %v, %v", s, err)
+	}
+	env := map[string]float64{"a": 6, "b": 1}
+	var got []float64
+	for _, sol := range s {
+		got = append(got, Eval(sol[x], env))
+		if r := residuals([]Expression{e}, sol, env); !almostEqual(r[0], 0) {
+			t.Errorf("Solve symbolic quadratic leaves residual %v", r[0])
+		}
+	}
+	if want := []float64{2, -3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Solve symbolic quadratic got %v, want %v", got, want)
+	}
+}
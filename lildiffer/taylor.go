@@ -0,0 +1,57 @@
+package lildiffer
+
+// Taylor returns the multivariate Taylor polynomial of e
+// in vars about point, up to total degree order. The
+// coefficient of each monomial is the matching partial
+// derivative at point over the factorial of its
+// multi-index. Variables of e outside vars are
+// parameters and must be bound in point too.
+//
+// Coefficients are floats. The factorials are exact
+// in a float64 up to order 22, so each coefficient
+// is its derivative's value at point divided by them
+// with a single rounding, and only exact zeros are
+// left out; past order 22 the factorials round too.
+func Taylor(e Expression, vars []Var, point map[string]float64, order int) Poly {
+	table := NewDerivativeTable(e)
+
+	// powers of (v - a) for each variable
+	shifts := make([][]Poly, len(vars))
+	for i, v := range vars {
+		a, ok := point[v.Name]
+		if !ok {
+			panic("unbound variable " + v.Name)
+		}
+		s := newPoly(map[string]float64{polyName(v): 1., "": -a})
+		shifts[i] = []Poly{newPoly(map[string]float64{"": 1.})}
+		for k := 1; k <= order; k++ {
+			shifts[i] = append(shifts[i], mul(shifts[i][k-1], s))
+		}
+	}
+
+	r := Poly{map[string]float64{}}
+	m := make(MultiIndex)
+	// walk every multi-index of total degree <= order
+	var walk func(i, left int)
+	walk = func(i, left int) {
+		if i == len(vars) {
+			c := Eval(table.Partial(m), point) / m.Factorial()
+			if c == 0 {
+				return
+			}
+			t := newPoly(map[string]float64{"": c})
+			for j, v := range vars {
+				t = mul(t, shifts[j][m[v]])
+			}
+			r = add(r, t)
+			return
+		}
+		for k := 0; k <= left; k++ {
+			m[vars[i]] = k
+			walk(i+1, left-k)
+		}
+		m[vars[i]] = 0
+	}
+	walk(0, order)
+	return r
+}
@@ -0,0 +1,74 @@
+package lildiffer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaylor(t *testing.T) {
+	type ptype map[string]float64
+	x, y := Var{"x"}, Var{"y"}
+	origin := map[string]float64{"x": 0, "y": 0}
+	table := []struct {
+		description string
+		f           Expression
+		vars        []Var
+		point       map[string]float64
+		order       int
+		series      Poly
+	}{
+		{"sin(x) about 0",
+			Sin{x}, []Var{x}, origin, 7,
+			newPoly(ptype{"x": 1, "x^3": -1. / 6, "x^5": 1. / 120, "x^7": -1. / 5040}),
+		},
+		{"cos(x) about 0",
+			Cos{x}, []Var{x}, origin, 6,
+			newPoly(ptype{"": 1, "x^2": -1. / 2, "x^4": 1. / 24, "x^6": -1. / 720}),
+		},
+		{"x^2 about 1 is exact",
+			Pow{x, 2.}, []Var{x}, map[string]float64{"x": 1}, 4,
+			newPoly(ptype{"x^2": 1}),
+		},
+		{"sin(x)cos(y) about 0",
+			Mul{Sin{x}, Cos{y}}, []Var{x, y}, origin, 3,
+			newPoly(ptype{"x": 1, "x^3": -1. / 6, "xy^2": -1. / 2}),
+		},
+		{"parameter a sin(x)",
+			Mul{Var{"a"}, Sin{x}}, []Var{x}, map[string]float64{"x": 0, "a": 2}, 3,
+			newPoly(ptype{"x": 2, "x^3": -1. / 3}),
+		},
+	}
+	for _, tt := range table {
+		got := Taylor(tt.f, tt.vars, tt.point, tt.order)
+		if len(got.terms) != len(tt.series.terms) {
+			t.Errorf("Taylor %v\ngot  %v\nwant %v", tt.description, got, tt.series)
+			continue
+		}
+		for key, want := range tt.series.terms {
+			if !almostEqual(got.terms[key], want) {
+				t.Errorf("Taylor %v\ngot  %v\nwant %v", tt.description, got, tt.series)
+				break
+			}
+		}
+	}
+	// high order coefficients are tiny but kept,
+	// and the factorials are exact
+	sin := Taylor(Sin{x}, []Var{x}, origin, 21)
+	fact := 1.
+	for k := 1; k <= 21; k++ {
+		fact *= float64(k)
+		want := 0.
+		if k%2 == 1 {
+			want = 1 / fact
+			if k%4 == 3 {
+				want = -want
+			}
+		}
+		if got := sin.terms[makePolyTerm([]string{"x"}, []int{k})]; got != want {
+			t.Errorf("Taylor Sin(x) x^%v coefficient got %v, want %v", k, got, want)
+		}
+	}
+	if got := Taylor(Cos{x}, []Var{x}, origin, 0); !reflect.DeepEqual(got, newPoly(ptype{"": 1})) {
+		t.Errorf("Taylor order 0 got %v", got)
+	}
+}
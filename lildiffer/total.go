@@ -0,0 +1,66 @@
+package lildiffer
+
+import (
+	"fmt"
+)
+
+// TotalDerive differentiates e with respect to wrt, where
+// the variables keyed in deps are intermediate and depend on
+// others through their expressions, e.g. x = r Cos(t). The
+// chain rule, the partial in wrt plus de/du du/dwrt summed
+// over the intermediates u, runs through deps recursively.
+// Any other variable is independent of wrt. The result is
+// in terms of the intermediate variables too; ForwardSub
+// them out if needed.
+//
+// Calls that don't pin down one reading are refused: wrt
+// itself declared dependent, or dependencies that cycle.
+func TotalDerive(e Expression, wrt Var, deps map[Var]Expression) (Expression, error) {
+	if _, ok := deps[wrt]; ok {
+		return nil, fmt.Errorf("%v is declared dependent, can't differentiate by it", wrt.Name)
+	}
+	// depth first search for cycles
+	state := make(map[Var]int)
+	var visit func(u Var, path []Var) error
+	visit = func(u Var, path []Var) error {
+		switch state[u] {
+		case 1:
+			return fmt.Errorf("cyclic dependency through %v", append(path, u))
+		case 2:
+			return nil
+		}
+		state[u] = 1
+		for _, w := range Variables(deps[u]) {
+			if _, ok := deps[w]; ok {
+				if err := visit(w, append(path, u)); err != nil {
+					return err
+				}
+			}
+		}
+		state[u] = 2
+		return nil
+	}
+	for u := range deps {
+		if err := visit(u, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	memo := make(map[Var]Expression)
+	var total func(e Expression) Expression
+	total = func(e Expression) Expression {
+		d := PartialDerive(wrt, e)
+		for _, u := range Variables(e) {
+			du, ok := deps[u]
+			if !ok {
+				continue
+			}
+			if _, ok := memo[u]; !ok {
+				memo[u] = makePoly(Simplify(total(du)))
+			}
+			d = Add{d, Mul{PartialDerive(u, e), memo[u]}}
+		}
+		return d
+	}
+	return makePoly(Simplify(total(e))), nil
+}
@@ -0,0 +1,58 @@
+package lildiffer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTotalDerive(t *testing.T) {
+	x, y, r, th := Var{"x"}, Var{"y"}, Var{"r"}, Var{"theta"}
+	polar := map[Var]Expression{
+		x: Mul{r, Cos{th}},
+		y: Mul{r, Sin{th}},
+	}
+	at := map[string]float64{"r": 2., "theta": .3,
+		"x": 2 * math.Cos(.3), "y": 2 * math.Sin(.3)}
+
+	u, w, s := Var{"u"}, Var{"w"}, Var{"s"}
+	chain := map[Var]Expression{
+		u: Pow{s, 2.},
+		w: Add{u, s},
+	}
+	table := []struct {
+		description string
+		f           Expression
+		wrt         Var
+		deps        map[Var]Expression
+		point       map[string]float64
+		want        float64
+	}{
+		{"d/dtheta x^2 + y^2", Add{Pow{x, 2.}, Pow{y, 2.}}, th, polar, at, 0},
+		{"d/dr x^2 + y^2", Add{Pow{x, 2.}, Pow{y, 2.}}, r, polar, at, 4},
+		{"d/dtheta x r", Mul{x, r}, th, polar, at, -4 * math.Sin(.3)},
+		{"d/ds w^2 through u", Pow{w, 2.}, s, chain,
+			map[string]float64{"s": 3, "u": 9, "w": 12}, 2 * 12 * 7},
+		{"d/ds a w, a independent", Mul{Var{"a"}, w}, s, chain,
+			map[string]float64{"s": 3, "u": 9, "w": 12, "a": 5}, 35},
+	}
+	for _, tt := range table {
+		d, err := TotalDerive(tt.f, tt.wrt, tt.deps)
+		if err != nil {
+			t.Errorf("TotalDerive %v: %v", tt.description, err)
+			continue
+		}
+		if got := Eval(d, tt.point); !almostEqual(got, tt.want) {
+			t.Errorf("TotalDerive %v got %v = %v, want %v",
+				tt.description, Read(d), got, tt.want)
+		}
+	}
+
+	// ambiguous calls
+	if _, err := TotalDerive(x, x, polar); err == nil {
+		t.Errorf("TotalDerive by a dependent variable should fail")
+	}
+	cyclic := map[Var]Expression{x: Mul{Num{2.}, y}, y: Add{x, r}}
+	if _, err := TotalDerive(x, r, cyclic); err == nil {
+		t.Errorf("TotalDerive through a cycle should fail")
+	}
+}